@@ -17,11 +17,19 @@ func _() {
 	_ = x[SliceInt-6]
 	_ = x[SliceDate-7]
 	_ = x[InValid-8]
+	_ = x[Bool-9]
+	_ = x[SliceBool-10]
+	_ = x[Duration-11]
+	_ = x[SliceDuration-12]
+	_ = x[ByteSize-13]
+	_ = x[Percent-14]
+	_ = x[SlicePercent-15]
+	_ = x[Decimal-16]
 }
 
-const _DataType_name = "StringFloatIntDateSliceStrSliceFloatSliceIntSliceDateInValid"
+const _DataType_name = "StringFloatIntDateSliceStrSliceFloatSliceIntSliceDateInValidBoolSliceBoolDurationSliceDurationByteSizePercentSlicePercentDecimal"
 
-var _DataType_index = [...]uint8{0, 6, 11, 14, 18, 26, 36, 44, 53, 60}
+var _DataType_index = [...]uint8{0, 6, 11, 14, 18, 26, 36, 44, 53, 60, 64, 73, 81, 94, 102, 109, 121, 128}
 
 func (i DataType) String() string {
 	if i < 0 || i >= DataType(len(_DataType_index)-1) {
@@ -0,0 +1,42 @@
+package keyval
+
+import (
+	"sort"
+	"strings"
+)
+
+// Change is a key whose value differs between two KeyVals.
+type Change struct {
+	Key string
+	Old *Value // Old is the Value in the first KeyVal
+	New *Value // New is the Value in the second KeyVal
+}
+
+// Diff compares a to b.  added holds the keys in b but not a, removed the keys in a but not b and changed
+// the keys in both whose values differ.  Values are compared as strings, ignoring leading and trailing spaces
+// and tabs.  The keys are sorted.
+func Diff(a, b KeyVal) (added, removed []string, changed []Change) {
+	for k, newVal := range b {
+		oldVal, ok := a[k]
+		if !ok {
+			added = append(added, k)
+			continue
+		}
+
+		if strings.Trim(oldVal.AsString, " \t") != strings.Trim(newVal.AsString, " \t") {
+			changed = append(changed, Change{Key: k, Old: oldVal, New: newVal})
+		}
+	}
+
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Key < changed[j].Key })
+
+	return added, removed, changed
+}
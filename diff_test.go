@@ -0,0 +1,29 @@
+package keyval
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := ReadKVString("host: localhost\nport: 80\nold: x\nname: app\n")
+	assert.Nil(t, err)
+
+	b, err := ReadKVString("host:   localhost\nport: 8080\nnew: y\nname: app2\nzz: 1\n")
+	assert.Nil(t, err)
+
+	added, removed, changed := Diff(a, b)
+	assert.Equal(t, []string{"new", "zz"}, added)
+	assert.Equal(t, []string{"old"}, removed)
+	assert.Len(t, changed, 2)
+	assert.Equal(t, "name", changed[0].Key)
+	assert.Equal(t, "port", changed[1].Key)
+	assert.Equal(t, 80, *changed[1].Old.AsInt)
+	assert.Equal(t, 8080, *changed[1].New.AsInt)
+
+	added, removed, changed = Diff(a, a)
+	assert.Nil(t, added)
+	assert.Nil(t, removed)
+	assert.Nil(t, changed)
+}
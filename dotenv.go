@@ -0,0 +1,97 @@
+package keyval
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadDotEnv reads the .env file specFile, which has lines of the form KEY=value.  A line may start with
+// "export ".  Values in double quotes may span lines and have the escapes \n, \t, \" and \; values in single
+// quotes are taken literally.  Lines starting with "#" are comments, as is the rest of an unquoted value after
+// " #".
+func ReadDotEnv(specFile string) (KeyVal, error) {
+	handle, e := os.Open(specFile)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = handle.Close() }()
+
+	return readDotEnv(handle, specFile)
+}
+
+// dotEnvEscapes replaces the escapes of double-quoted .env values.
+var dotEnvEscapes = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+
+// readDotEnv reads the .env content of r.  specFile names r in errors.
+func readDotEnv(r io.Reader, specFile string) (KeyVal, error) {
+	var keys, vals []string
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.Trim(scanner.Text(), " \t\r")
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		key, val, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		if key = strings.Trim(key, " \t"); !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, &ParseError{File: specFile, Line: line, Text: text}
+		}
+
+		start := line
+		switch val = strings.TrimLeft(val, " \t"); {
+		case strings.HasPrefix(val, `"`):
+			// the value continues until the closing quote
+			end := closingQuote(val)
+			for end < 0 && scanner.Scan() {
+				line++
+				val += "\n" + strings.TrimRight(scanner.Text(), "\r")
+				end = closingQuote(val)
+			}
+
+			if end < 0 {
+				return nil, &ParseError{File: specFile, Line: start, Text: text}
+			}
+
+			val = dotEnvEscapes.Replace(val[1:end])
+		case strings.HasPrefix(val, "'"):
+			end := strings.Index(val[1:], "'")
+			if end < 0 {
+				return nil, &ParseError{File: specFile, Line: start, Text: text}
+			}
+
+			val = val[1 : end+1]
+		default:
+			if loc := strings.Index(val, " #"); loc >= 0 {
+				val = val[:loc]
+			}
+
+			val = strings.TrimRight(val, " \t")
+		}
+
+		keys = append(keys, key)
+		vals = append(vals, val)
+	}
+
+	if e := scanner.Err(); e != nil {
+		return nil, e
+	}
+
+	return ProcessKVs(keys, vals)
+}
+
+// closingQuote returns the index of the unescaped double quote that closes the quoted value val, or -1.
+func closingQuote(val string) int {
+	for ind := 1; ind < len(val); ind++ {
+		switch val[ind] {
+		case '\\':
+			ind++
+		case '"':
+			return ind
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,44 @@
+package keyval
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDotEnv(t *testing.T) {
+	const content = `# database
+export DB_HOST=localhost
+DB_PORT = 5432 # default port
+GREETING="hello \"world\"\nbye"
+RAW='a\nb # not a comment'
+CERT="line 1
+line 2"
+EMPTY=
+`
+	fileName := filepath.Join(t.TempDir(), ".env")
+	assert.Nil(t, os.WriteFile(fileName, []byte(content), 0644))
+
+	kv, err := ReadDotEnv(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"DB_HOST", "DB_PORT", "GREETING", "RAW", "CERT", "EMPTY"}, kv.Keys())
+	assert.Equal(t, "localhost", kv.GetTrim("DB_HOST"))
+	assert.Equal(t, 5432, *kv.Get("DB_PORT").AsInt)
+	assert.Equal(t, "hello \"world\"\nbye", kv.Get("GREETING").AsString)
+	assert.Equal(t, `a\nb # not a comment`, kv.Get("RAW").AsString)
+	assert.Equal(t, "line 1\nline 2", kv.Get("CERT").AsString)
+	assert.Equal(t, "", kv.Get("EMPTY").AsString)
+
+	for content, msg := range map[string]string{
+		"A=1\nnot a pair\n": "bad key val: not a pair in file " + fileName + ", line 2",
+		"A=1\nB=\"open\n":   "bad key val: B=\"open in file " + fileName + ", line 2",
+		"A='open\n":         "bad key val: A='open in file " + fileName + ", line 1",
+		"BAD KEY=1\n":       "bad key val: BAD KEY=1 in file " + fileName + ", line 1",
+	} {
+		assert.Nil(t, os.WriteFile(fileName, []byte(content), 0644))
+		_, err = ReadDotEnv(fileName)
+		assert.EqualError(t, err, msg, content)
+	}
+}
@@ -0,0 +1,164 @@
+package keyval
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// kvEntry locates a key/val entry within the lines of a keyval file.
+type kvEntry struct {
+	key   string
+	start int   // line with the key
+	cont  []int // continuation lines of the value
+}
+
+// EditValue replaces the value of key in file with newValue, leaving the rest of the file, including comments,
+// untouched.  If the value spans multiple lines, including a block value, the continuation lines are removed.  An
+// inline comment on the line with the key is kept.  For a file read with Options, use EditValueOpts.
+//
+// If key occurs more than once in file, the first occurrence is edited.  Other occurrences are specified as they
+// are in KeyVal: "key"2 is the second occurrence, etc.
+//
+// Only file itself is edited: keys loaded via include are not found.
+func EditValue(file, key, newValue string) error {
+	return EditValueOpts(file, key, newValue, Options{})
+}
+
+// EditValueOpts is EditValue for a file read with opts.  The delimiters, comment prefix, end of line and key
+// normalization of opts are used to find key, as ReadKVOpts does.
+func EditValueOpts(file, key, newValue string, opts Options) error {
+	info, e := os.Stat(file)
+	if e != nil {
+		return e
+	}
+
+	content, e := os.ReadFile(file)
+	if e != nil {
+		return e
+	}
+
+	if opts.CaseInsensitiveKeys {
+		key = strings.ToLower(key)
+	}
+
+	lines := strings.SplitAfter(string(content), opts.lineEOL())
+	entry := findEntry(locateEntries(lines, opts), key)
+	if entry == nil {
+		return newKeyError(ErrMissingKey, key, "", "", fmt.Sprintf("key %s not found in file %s", key, file))
+	}
+
+	lines[entry.start] = replaceValue(lines[entry.start], newValue, opts)
+	for _, ind := range entry.cont {
+		lines[ind] = ""
+	}
+
+	return os.WriteFile(file, []byte(strings.Join(lines, "")), info.Mode())
+}
+
+// locateEntries finds the entries in lines using the same rules as ReadKV2SlcOpts with opts.
+func locateEntries(lines []string, opts Options) []*kvEntry {
+	var (
+		entries []*kvEntry
+		current *kvEntry
+	)
+
+	continued := false
+	tag := ""
+	for ind, line := range lines {
+		// the lines of a block value, including the one with the tag, belong to the current entry
+		if tag != "" {
+			current.cont = append(current.cont, ind)
+			if strings.Trim(strings.TrimRight(line, opts.lineEOL()), " \t") == tag {
+				tag = ""
+			}
+
+			continue
+		}
+
+		line = strings.TrimLeft(strings.TrimRight(line, opts.lineEOL()), " ")
+		if len(line) < 2 || strings.HasPrefix(line, opts.commentPrefix()) {
+			continue
+		}
+
+		if loc := commentIndex(line, opts.commentPrefix()); loc >= 0 {
+			line = line[0:loc]
+		}
+
+		prior := continued
+		continued = strings.HasSuffix(strings.TrimRight(line, " "), `\`)
+
+		if prior || !strings.Contains(line, opts.kvDelim()) {
+			if current != nil {
+				current.cont = append(current.cont, ind)
+			}
+
+			continue
+		}
+
+		key := opts.normalizeKey(strings.SplitN(line, opts.kvDelim(), 2)[0])
+		if opts.CaseInsensitiveKeys {
+			key = strings.ToLower(key)
+		}
+
+		current = &kvEntry{key: key, start: ind}
+		entries = append(entries, current)
+		if !continued {
+			tag = blockTag(line, opts.kvDelim())
+		}
+	}
+
+	return entries
+}
+
+// findEntry returns the entry for key.  If key is not found directly, it is treated as "root"n, the nth
+// occurrence of root.
+func findEntry(entries []*kvEntry, key string) *kvEntry {
+	for _, entry := range entries {
+		if entry.key == key {
+			return entry
+		}
+	}
+
+	for ind := len(key) - 1; ind > 0 && key[ind] >= '0' && key[ind] <= '9'; ind-- {
+		occurrence, _ := strconv.Atoi(key[ind:])
+		count := 0
+		for _, entry := range entries {
+			if entry.key != key[:ind] {
+				continue
+			}
+
+			if count++; count == occurrence {
+				return entry
+			}
+		}
+	}
+
+	return nil
+}
+
+// replaceValue replaces the value in line with newValue, keeping the spacing after the delimiter, any inline
+// comment and the end of line.
+func replaceValue(line, newValue string, opts Options) string {
+	eol := ""
+	if strings.HasSuffix(line, opts.lineEOL()) {
+		line, eol = strings.TrimSuffix(line, opts.lineEOL()), opts.lineEOL()
+	}
+
+	start := strings.Index(line, opts.kvDelim()) + len(opts.kvDelim())
+	for start < len(line) && line[start] == ' ' {
+		start++
+	}
+
+	end := len(line)
+	if loc := commentIndex(line[start:], opts.commentPrefix()); loc >= 0 {
+		end = start + len(strings.TrimRight(line[start:start+loc], " "))
+		// keep the comment separated from the value
+		if end == start+loc {
+			newValue += " "
+		}
+	}
+
+	return line[:start] + newValue + line[end:] + eol
+}
@@ -0,0 +1,91 @@
+package keyval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditValue(t *testing.T) {
+	const content = `// Test file
+a: hello   // greeting
+b: a,b,c,
+   d,e,f
+// equations
+eqn: a=b
+eqn: b=c
+c: 1
+`
+	fileName := filepath.Join(t.TempDir(), "edit.txt")
+	assert.Nil(t, os.WriteFile(fileName, []byte(content), 0644))
+
+	assert.Nil(t, EditValue(fileName, "a", "goodbye"))
+	assert.Nil(t, EditValue(fileName, "b", "x,y"))
+	assert.Nil(t, EditValue(fileName, "eqn2", "c=d"))
+	assert.EqualError(t, EditValue(fileName, "z", "1"), "key z not found in file "+fileName)
+
+	exp := `// Test file
+a: goodbye   // greeting
+b: x,y
+// equations
+eqn: a=b
+eqn: c=d
+c: 1
+`
+	act, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, exp, string(act))
+
+	kv, err := ReadKV(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a=b", "c=d"}, kv.GetMultipleTrim("eqn"))
+}
+
+func TestEditValue_Continuation(t *testing.T) {
+	const content = "url: \\\n  http://host:8080/path\nb: 1\n"
+	fileName := filepath.Join(t.TempDir(), "edit.txt")
+	assert.Nil(t, os.WriteFile(fileName, []byte(content), 0644))
+
+	assert.Nil(t, EditValue(fileName, "url", "http://other:80/"))
+	act, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, "url: http://other:80/\nb: 1\n", string(act))
+}
+
+func TestEditValue_Block(t *testing.T) {
+	const content = "script: <<END\necho hi\nx: 1\nEND\nx: 2\n"
+	fileName := filepath.Join(t.TempDir(), "edit.txt")
+	assert.Nil(t, os.WriteFile(fileName, []byte(content), 0644))
+
+	assert.Nil(t, EditValue(fileName, "x", "3"))
+	assert.Nil(t, EditValue(fileName, "script", "done"))
+	act, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, "script: done\nx: 3\n", string(act))
+}
+
+func TestEditValueOpts(t *testing.T) {
+	const content = "# limits\nmax conns = 10 # per host\nName = app\nurl = http://host//x\n"
+	fileName := filepath.Join(t.TempDir(), "edit.ini")
+	assert.Nil(t, os.WriteFile(fileName, []byte(content), 0644))
+
+	opts := Options{KVDelim: "=", CommentPrefix: "#", CaseInsensitiveKeys: true,
+		NormalizeKey: func(key string) string { return strings.ReplaceAll(strings.Trim(key, " "), " ", "_") }}
+	assert.Nil(t, EditValueOpts(fileName, "max_conns", "20", opts))
+	assert.Nil(t, EditValueOpts(fileName, "name", "web", opts))
+	assert.Nil(t, EditValueOpts(fileName, "url", "http://other//y", opts))
+
+	act, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, "# limits\nmax conns = 20 # per host\nName = web\nurl = http://other//y\n", string(act))
+
+	kv, err := ReadKVOpts(fileName, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, *kv.Get("max_conns").AsInt)
+
+	// the default options don't find the key
+	assert.ErrorIs(t, EditValue(fileName, "max_conns", "30"), ErrMissingKey)
+}
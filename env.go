@@ -0,0 +1,42 @@
+package keyval
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// envName returns the name of the environment variable for key: key in upper case with "." and "-" replaced
+// by "_", after prefix and "_".
+func envName(prefix, key string) string {
+	return strings.ToUpper(prefix) + "_" + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// ApplyEnv sets keys in kv from environment variables.  A key is set from the variable named by prefix, "_"
+// and the key in upper case with "." and "-" replaced by "_", so with prefix MYAPP the key db.host is set from
+// MYAPP_DB_HOST.  The value is converted by Populate.  Only keys already in kv are set: other variables that
+// start with prefix are ignored.  ApplyEnv returns the keys set, sorted.
+//
+// prefix must not be empty, so unrelated variables, such as HOME or PATH, can't override keys.  With an empty
+// prefix, no keys are set.
+func (kv KeyVal) ApplyEnv(prefix string) (keys []string) {
+	return kv.ApplyEnvOpts(prefix, Options{})
+}
+
+// ApplyEnvOpts is ApplyEnv with the values converted using the ListDelim, DateFormats, etc. of opts.
+func (kv KeyVal) ApplyEnvOpts(prefix string, opts Options) (keys []string) {
+	if prefix == "" {
+		return nil
+	}
+
+	for key, v := range kv {
+		if val, ok := os.LookupEnv(envName(prefix, key)); ok {
+			kv[key] = v.repopulate(val, opts)
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
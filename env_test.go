@@ -0,0 +1,39 @@
+package keyval
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyVal_ApplyEnv(t *testing.T) {
+	kv, err := ReadKVString("db.host: localhost\ndb.port: 5432\nlog-level: info\nname: app\n")
+	assert.Nil(t, err)
+
+	t.Setenv("MYAPP_DB_HOST", "db.example.com")
+	t.Setenv("MYAPP_DB_PORT", "6543")
+	t.Setenv("MYAPP_LOG_LEVEL", "debug")
+	t.Setenv("MYAPP_CACHE_SIZE", "64")
+	t.Setenv("OTHER_NAME", "other")
+
+	keys := kv.ApplyEnv("myapp")
+	assert.Equal(t, []string{"db.host", "db.port", "log-level"}, keys)
+	assert.Equal(t, "db.example.com", kv.GetTrim("db.host"))
+	assert.Equal(t, 6543, *kv.Get("db.port").AsInt)
+	assert.Equal(t, "debug", kv.GetTrim("log-level"))
+	assert.Equal(t, "app", kv.GetTrim("name"))
+
+	// variables that match no key are ignored
+	assert.Nil(t, kv.Get("cache.size"))
+
+	// without a prefix, nothing is set
+	t.Setenv("NAME", "env")
+	assert.Nil(t, kv.ApplyEnv(""))
+	assert.Equal(t, "app", kv.GetTrim("name"))
+
+	// the list delimiter of the Options is used
+	t.Setenv("MYAPP_NAME", "a;b")
+	keys = kv.ApplyEnvOpts("myapp", Options{ListDelim: ";"})
+	assert.Equal(t, []string{"db.host", "db.port", "log-level", "name"}, keys)
+	assert.Equal(t, []string{"a", "b"}, kv.Get("name").AsSliceS)
+}
@@ -0,0 +1,36 @@
+package keyval
+
+import "errors"
+
+// The kinds of violation reported by KeyError.  Use errors.Is to test for them.
+var (
+	ErrMissingKey   = errors.New("missing key")
+	ErrBadType      = errors.New("bad type")
+	ErrIllegalValue = errors.New("illegal value")
+	ErrUnknownKey   = errors.New("unknown key")
+	ErrConflict     = errors.New("conflicting keys")
+)
+
+// KeyError is returned when a key violates the legals or is missing.  errors.Is(e, ErrMissingKey), etc.,
+// reports the kind of violation.
+type KeyError struct {
+	Key      string // Key is the key with the error.  For ErrUnknownKey, it is the unknown keys separated by commas.
+	Kind     error  // Kind is one of ErrMissingKey, ErrBadType, ErrIllegalValue, ErrUnknownKey or ErrConflict
+	Expected string // Expected, if not empty, is what the legals require, such as a type or a bound
+	Actual   string // Actual, if not empty, is the value found
+	msg      string
+}
+
+// newKeyError returns a KeyError with message msg.
+func newKeyError(kind error, key, expected, actual, msg string) *KeyError {
+	return &KeyError{Key: key, Kind: kind, Expected: expected, Actual: actual, msg: msg}
+}
+
+func (ke *KeyError) Error() string {
+	return ke.msg
+}
+
+// Unwrap returns the Kind of ke.
+func (ke *KeyError) Unwrap() error {
+	return ke.Kind
+}
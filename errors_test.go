@@ -0,0 +1,122 @@
+package keyval
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyError(t *testing.T) {
+	const legalDefs = `
+host:required-yes
+port:required-no
+port:type-int
+color:required-no
+color:values-red,green
+level:required-no
+level:max-10`
+
+	kv, err := ReadKVString("port: http\ncolor: blue\nlevel: 11\nextra: 1\n")
+	assert.Nil(t, err)
+
+	report := CheckLegalsAll(kv, legalDefs)
+	assert.Len(t, report.Errors, 5)
+
+	var ke *KeyError
+	for ind, want := range []struct {
+		kind                  error
+		key, expected, actual string
+	}{
+		{ErrMissingKey, "host", "", ""},
+		{ErrBadType, "port", "int", "http"},
+		{ErrIllegalValue, "color", "red,green", "blue"},
+		{ErrIllegalValue, "level", "max 10", "11"},
+		{ErrUnknownKey, "extra", "", ""},
+	} {
+		assert.True(t, errors.Is(report.Errors[ind], want.kind), report.Errors[ind].Error())
+		assert.True(t, errors.As(report.Errors[ind], &ke))
+		assert.Equal(t, want.key, ke.Key)
+		assert.Equal(t, want.expected, ke.Expected)
+		assert.Equal(t, want.actual, ke.Actual)
+	}
+
+	assert.EqualError(t, report.Errors[1], "value to key port must be integer")
+	assert.False(t, errors.Is(report.Errors[1], ErrIllegalValue))
+
+	_, err = Get[int](kv, "port")
+	assert.True(t, errors.Is(err, ErrBadType))
+	_, err = Get[int](kv, "missing")
+	assert.True(t, errors.Is(err, ErrMissingKey))
+}
+
+func TestKeyError_Groups(t *testing.T) {
+	const legalDefs = `
+source:oneof-file,inline
+address:anyof-host,ip
+output:exclusive-stdout,log
+quiet:required-no
+quiet:conflicts-verbose
+verbose:required-no
+file:required-no
+inline:required-no
+host:required-no
+ip:required-no
+stdout:required-no
+log:required-no`
+
+	kv, err := ReadKVString("file: a\ninline: b\nstdout: yes\nlog: x\nquiet: yes\nverbose: yes\n")
+	assert.Nil(t, err)
+
+	report := CheckLegalsAll(kv, legalDefs)
+	assert.Len(t, report.Errors, 4)
+
+	var ke *KeyError
+	for ind, want := range []struct {
+		kind                  error
+		key, expected, actual string
+	}{
+		{ErrConflict, "source", "file,inline", "2"},
+		{ErrMissingKey, "address", "host,ip", "0"},
+		{ErrConflict, "output", "stdout,log", "2"},
+		{ErrConflict, "quiet", "", "verbose"},
+	} {
+		assert.True(t, errors.Is(report.Errors[ind], want.kind), report.Errors[ind].Error())
+		assert.True(t, errors.As(report.Errors[ind], &ke))
+		assert.Equal(t, want.key, ke.Key)
+		assert.Equal(t, want.expected, ke.Expected)
+		assert.Equal(t, want.actual, ke.Actual)
+	}
+
+	assert.EqualError(t, report.Errors[0], "exactly one of [file inline] required, got 2")
+	assert.EqualError(t, report.Errors[3], "key quiet conflicts with key verbose")
+
+	// oneof with none present is a missing key
+	kv, err = ReadKVString("host: a\n")
+	assert.Nil(t, err)
+	err = CheckLegals(kv, legalDefs)
+	assert.True(t, errors.Is(err, ErrMissingKey))
+	assert.EqualError(t, err, "exactly one of [file inline] required, got 0")
+}
+
+func TestKeyError_RelationsAndAliases(t *testing.T) {
+	kv, err := ReadKVString("min: 20\nmax: 10\n")
+	assert.Nil(t, err)
+	err = CheckLegals(kv, "min:required-yes\nmax:required-yes\nlimits:relation-min<=max")
+	assert.True(t, errors.Is(err, ErrIllegalValue), err.Error())
+
+	kv, err = ReadKVString("host: a\nserver: b\nhostname: c\n")
+	assert.Nil(t, err)
+	_, err = ApplyAliases(kv, "host:required-yes\nhost:alias-hostname")
+	assert.EqualError(t, err, "key host and its alias hostname are both present")
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	_, err = ApplyAliases(kv, "host:required-yes\nserver:deprecated-host")
+	assert.EqualError(t, err, "key server and its replacement host are both present")
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	var ke *KeyError
+	assert.True(t, errors.As(err, &ke))
+	assert.Equal(t, "server", ke.Key)
+	assert.Equal(t, "host", ke.Actual)
+}
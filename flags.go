@@ -0,0 +1,34 @@
+package keyval
+
+import (
+	"flag"
+	"strings"
+)
+
+// BindFlags defines a flag on fs for each key in kv that fs does not already have.  The default of the flag
+// is the value in kv and its usage is the first line of the comment of the key.  Setting the flag replaces
+// the Value in kv, so flags given on the command line take precedence over the keyval file.
+func (kv KeyVal) BindFlags(fs *flag.FlagSet) {
+	for _, key := range kv.Keys() {
+		if fs.Lookup(key) != nil {
+			continue
+		}
+
+		usage, _, _ := strings.Cut(kv[key].Comment, "\n")
+		fs.TextVar(kv[key], key, kv[key].clone(), usage)
+	}
+}
+
+// ApplyFlags sets the keys in kv from the flags in fs that were set on the command line.  A key is added to kv
+// if it is not present.  The value of the flag is converted by Populate.
+func (kv KeyVal) ApplyFlags(fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		key := kv.foldKey(f.Name)
+		if v, ok := kv[key]; ok {
+			kv[key] = v.repopulate(f.Value.String(), Options{})
+			return
+		}
+
+		kv[key] = Populate(f.Value.String())
+	})
+}
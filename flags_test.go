@@ -0,0 +1,44 @@
+package keyval
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyVal_BindFlags(t *testing.T) {
+	kv, err := ReadKVString("// port to listen on\nport: 80\nhosts: a, b\nname: app\n")
+	assert.Nil(t, err)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("name", "other", "already defined")
+	kv.BindFlags(fs)
+
+	assert.Equal(t, "port to listen on", fs.Lookup("port").Usage)
+	assert.Equal(t, "80", fs.Lookup("port").DefValue)
+	assert.Equal(t, "already defined", fs.Lookup("name").Usage)
+
+	assert.Nil(t, fs.Parse([]string{"-port", "8080", "-hosts", "c,d,e", "-name", "cli"}))
+	assert.Equal(t, 8080, *kv.Get("port").AsInt)
+	assert.Equal(t, "port to listen on", kv.Get("port").Comment)
+	assert.Equal(t, []string{"c", "d", "e"}, kv.Get("hosts").AsSliceS)
+	assert.Equal(t, "app", kv.GetTrim("name"))
+}
+
+func TestKeyVal_ApplyFlags(t *testing.T) {
+	kv, err := ReadKVString("port: 80\nname: app\n")
+	assert.Nil(t, err)
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("port", 80, "port")
+	fs.String("name", "app", "name")
+	fs.Bool("verbose", false, "verbose")
+	assert.Nil(t, fs.Parse([]string{"-port", "9090", "-verbose"}))
+
+	kv.ApplyFlags(fs)
+	assert.Equal(t, 9090, *kv.Get("port").AsInt)
+	assert.Equal(t, "app", kv.GetTrim("name"))
+	assert.True(t, *kv.Get("verbose").AsBool)
+	assert.Equal(t, []string{"port", "name", "verbose"}, kv.Keys())
+}
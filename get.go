@@ -0,0 +1,230 @@
+package keyval
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// getAs returns the element of the Value of key of type dt.  See Value.GetAs.
+func (kv KeyVal) getAs(key string, dt DataType) (any, error) {
+	val := kv.Get(key)
+	if val == nil {
+		return nil, newKeyError(ErrMissingKey, key, "", "", fmt.Sprintf("key %s not found", key))
+	}
+
+	data, e := val.GetAs(dt)
+	if e != nil {
+		return nil, newKeyError(ErrBadType, key, dt.String(), strings.Trim(val.AsString, " "),
+			fmt.Sprintf("key %s: %v", key, e))
+	}
+
+	return data, nil
+}
+
+// GetString returns the value of key with leading and trailing spaces removed, or def if key is missing.
+func (kv KeyVal) GetString(key, def string) string {
+	if val := kv.Get(key); val != nil {
+		return strings.Trim(val.AsString, " ")
+	}
+
+	return def
+}
+
+// GetInt returns the value of key as an int, or def if key is missing or is not an int.
+func (kv KeyVal) GetInt(key string, def int) int {
+	if data, e := kv.getAs(key, Int); e == nil {
+		return *data.(*int)
+	}
+
+	return def
+}
+
+// GetFloat returns the value of key as a float64, or def if key is missing or is not a number.
+func (kv KeyVal) GetFloat(key string, def float64) float64 {
+	if data, e := kv.getAs(key, Float); e == nil {
+		return *data.(*float64)
+	}
+
+	return def
+}
+
+// GetDate returns the value of key as a time.Time, or def if key is missing or is not a date.
+func (kv KeyVal) GetDate(key string, def time.Time) time.Time {
+	if data, e := kv.getAs(key, Date); e == nil {
+		return *data.(*time.Time)
+	}
+
+	return def
+}
+
+// GetBool returns the value of key as a bool, or def if key is missing or is not a bool.
+func (kv KeyVal) GetBool(key string, def bool) bool {
+	if data, e := kv.getAs(key, Bool); e == nil {
+		return *data.(*bool)
+	}
+
+	return def
+}
+
+// GetDuration returns the value of key as a time.Duration, or def if key is missing or is not a duration.
+func (kv KeyVal) GetDuration(key string, def time.Duration) time.Duration {
+	if data, e := kv.getAs(key, Duration); e == nil {
+		return *data.(*time.Duration)
+	}
+
+	return def
+}
+
+// GetBytes returns the value of key as a number of bytes, or def if key is missing or is not a byte size.
+func (kv KeyVal) GetBytes(key string, def int64) int64 {
+	if data, e := kv.getAs(key, ByteSize); e == nil {
+		return *data.(*int64)
+	}
+
+	return def
+}
+
+// GetPercent returns the value of key as a fraction, so 75% is 0.75, or def if key is missing or is not a percent.
+func (kv KeyVal) GetPercent(key string, def float64) float64 {
+	if data, e := kv.getAs(key, Percent); e == nil {
+		return *data.(*float64)
+	}
+
+	return def
+}
+
+// GetDecimal returns the value of key as a decimal, or def if key is missing or is not a decimal.  The KeyVal must
+// be read with Decimal set in the Options.  The decimal returned is a copy.
+func (kv KeyVal) GetDecimal(key string, def *big.Rat) *big.Rat {
+	if data, e := kv.getAs(key, Decimal); e == nil {
+		return new(big.Rat).Set(data.(*big.Rat))
+	}
+
+	return def
+}
+
+// GetSlice returns the value of key as a []string, or def if key is missing or empty.
+func (kv KeyVal) GetSlice(key string, def []string) []string {
+	if data, e := kv.getAs(key, SliceStr); e == nil {
+		return data.([]string)
+	}
+
+	return def
+}
+
+// mustGetAs is getAs that panics if there is an error.
+func (kv KeyVal) mustGetAs(key string, dt DataType) any {
+	data, e := kv.getAs(key, dt)
+	if e != nil {
+		panic(fmt.Sprintf("keyval: %v", e))
+	}
+
+	return data
+}
+
+// MustGetString returns the value of key with leading and trailing spaces removed.  It panics if key is missing.
+func (kv KeyVal) MustGetString(key string) string {
+	return strings.Trim(kv.mustGetAs(key, String).(string), " ")
+}
+
+// MustGetInt returns the value of key as an int.  It panics if key is missing or is not an int.
+func (kv KeyVal) MustGetInt(key string) int {
+	return *kv.mustGetAs(key, Int).(*int)
+}
+
+// MustGetFloat returns the value of key as a float64.  It panics if key is missing or is not a number.
+func (kv KeyVal) MustGetFloat(key string) float64 {
+	return *kv.mustGetAs(key, Float).(*float64)
+}
+
+// MustGetDate returns the value of key as a time.Time.  It panics if key is missing or is not a date.
+func (kv KeyVal) MustGetDate(key string) time.Time {
+	return *kv.mustGetAs(key, Date).(*time.Time)
+}
+
+// MustGetBool returns the value of key as a bool.  It panics if key is missing or is not a bool.
+func (kv KeyVal) MustGetBool(key string) bool {
+	return *kv.mustGetAs(key, Bool).(*bool)
+}
+
+// MustGetDuration returns the value of key as a time.Duration.  It panics if key is missing or is not a duration.
+func (kv KeyVal) MustGetDuration(key string) time.Duration {
+	return *kv.mustGetAs(key, Duration).(*time.Duration)
+}
+
+// MustGetBytes returns the value of key as a number of bytes.  It panics if key is missing or is not a byte size.
+func (kv KeyVal) MustGetBytes(key string) int64 {
+	return *kv.mustGetAs(key, ByteSize).(*int64)
+}
+
+// MustGetPercent returns the value of key as a fraction, so 75% is 0.75.  It panics if key is missing or is not a
+// percent.
+func (kv KeyVal) MustGetPercent(key string) float64 {
+	return *kv.mustGetAs(key, Percent).(*float64)
+}
+
+// MustGetDecimal returns a copy of the value of key as a decimal.  It panics if key is missing or is not a decimal.
+func (kv KeyVal) MustGetDecimal(key string) *big.Rat {
+	return new(big.Rat).Set(kv.mustGetAs(key, Decimal).(*big.Rat))
+}
+
+// MustGetSlice returns the value of key as a []string.  It panics if key is missing or empty.
+func (kv KeyVal) MustGetSlice(key string) []string {
+	return kv.mustGetAs(key, SliceStr).([]string)
+}
+
+// Get returns the value of key as a T.  T may be string, int, float64, time.Time, bool, time.Duration or a slice
+// of one of these.  A string has leading and trailing spaces removed.  An error is returned if key is missing,
+// its value cannot be represented as a T or T is not supported.
+func Get[T any](kv KeyVal, key string) (T, error) {
+	var zero T
+
+	var dt DataType
+	switch any(zero).(type) {
+	case string:
+		dt = String
+	case int:
+		dt = Int
+	case float64:
+		dt = Float
+	case time.Time:
+		dt = Date
+	case bool:
+		dt = Bool
+	case time.Duration:
+		dt = Duration
+	case []string:
+		dt = SliceStr
+	case []int:
+		dt = SliceInt
+	case []float64:
+		dt = SliceFloat
+	case []time.Time:
+		dt = SliceDate
+	case []bool:
+		dt = SliceBool
+	case []time.Duration:
+		dt = SliceDuration
+	default:
+		return zero, fmt.Errorf("unsupported type %T", zero)
+	}
+
+	data, e := kv.getAs(key, dt)
+	if e != nil {
+		return zero, e
+	}
+
+	if dt == String {
+		data = strings.Trim(data.(string), " ")
+	}
+
+	// the unary types are returned by GetAs as pointers
+	if rv := reflect.ValueOf(data); rv.Kind() == reflect.Pointer {
+		data = rv.Elem().Interface()
+	}
+
+	return data.(T), nil
+}
@@ -0,0 +1,112 @@
+package keyval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyVal_GetDefaults(t *testing.T) {
+	kv, err := ReadKVString(`name:  app
+port: 80
+rate: 2
+start: 20230101
+debug: yes
+timeout: 30s
+hosts: a, b
+mem: 4KiB
+load: 75%
+`)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "app", kv.GetString("name", "x"))
+	assert.Equal(t, "x", kv.GetString("missing", "x"))
+
+	assert.Equal(t, 80, kv.GetInt("port", 8080))
+	assert.Equal(t, 8080, kv.GetInt("missing", 8080))
+	assert.Equal(t, 8080, kv.GetInt("name", 8080))
+
+	assert.Equal(t, 2.0, kv.GetFloat("rate", 1.5))
+	assert.Equal(t, 1.5, kv.GetFloat("name", 1.5))
+
+	def := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), kv.GetDate("start", def))
+	assert.Equal(t, def, kv.GetDate("port", def))
+
+	assert.True(t, kv.GetBool("debug", false))
+	assert.True(t, kv.GetBool("port", true))
+
+	assert.Equal(t, 30*time.Second, kv.GetDuration("timeout", time.Minute))
+	assert.Equal(t, time.Minute, kv.GetDuration("missing", time.Minute))
+
+	assert.Equal(t, int64(4096), kv.GetBytes("mem", 0))
+	assert.Equal(t, int64(1), kv.GetBytes("timeout", 1))
+
+	assert.Equal(t, 0.75, kv.GetPercent("load", 0.5))
+	assert.Equal(t, 0.5, kv.GetPercent("rate", 0.5))
+
+	assert.Equal(t, []string{"a", "b"}, kv.GetSlice("hosts", nil))
+	assert.Equal(t, []string{"z"}, kv.GetSlice("missing", []string{"z"}))
+}
+
+func TestKeyVal_MustGet(t *testing.T) {
+	kv, err := ReadKVString("name: app\nport: 80\nrate: 2.5\nstart: 20230101\ndebug: off\ntimeout: 1m\nhosts: a, b\n" +
+		"mem: 2GB\nload: 20%\n")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "app", kv.MustGetString("name"))
+	assert.Equal(t, 80, kv.MustGetInt("port"))
+	assert.Equal(t, 2.5, kv.MustGetFloat("rate"))
+	assert.Equal(t, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), kv.MustGetDate("start"))
+	assert.False(t, kv.MustGetBool("debug"))
+	assert.Equal(t, time.Minute, kv.MustGetDuration("timeout"))
+	assert.Equal(t, int64(2e9), kv.MustGetBytes("mem"))
+	assert.Equal(t, 0.2, kv.MustGetPercent("load"))
+	assert.Equal(t, []string{"a", "b"}, kv.MustGetSlice("hosts"))
+
+	assert.PanicsWithValue(t, "keyval: key missing not found", func() { kv.MustGetString("missing") })
+	assert.PanicsWithValue(t, "keyval: key name: value cannot be represented as Int", func() { kv.MustGetInt("name") })
+}
+
+func TestGet(t *testing.T) {
+	kv, err := ReadKVString("name: app \nport: 80\nrate: 2\ndebug: on\ntimeout: 1m\nports: 80, 443\nwaits: 1s, 2s\n")
+	assert.Nil(t, err)
+
+	name, err := Get[string](kv, "name")
+	assert.Nil(t, err)
+	assert.Equal(t, "app", name)
+
+	port, err := Get[int](kv, "port")
+	assert.Nil(t, err)
+	assert.Equal(t, 80, port)
+
+	rate, err := Get[float64](kv, "rate")
+	assert.Nil(t, err)
+	assert.Equal(t, 2.0, rate)
+
+	debug, err := Get[bool](kv, "debug")
+	assert.Nil(t, err)
+	assert.True(t, debug)
+
+	timeout, err := Get[time.Duration](kv, "timeout")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, timeout)
+
+	ports, err := Get[[]int](kv, "ports")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{80, 443}, ports)
+
+	waits, err := Get[[]time.Duration](kv, "waits")
+	assert.Nil(t, err)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, waits)
+
+	_, err = Get[int](kv, "name")
+	assert.EqualError(t, err, "key name: value cannot be represented as Int")
+
+	_, err = Get[int](kv, "missing")
+	assert.EqualError(t, err, "key missing not found")
+
+	_, err = Get[int32](kv, "port")
+	assert.EqualError(t, err, "unsupported type int32")
+}
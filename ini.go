@@ -0,0 +1,64 @@
+package keyval
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// ReadINI reads the INI file specFile.  Keys are separated from values by "=" and the keys in a section
+// [name] are prefixed by "name.", so Sub("name") returns the section.  Lines starting with ";" or "#" are
+// comments, as is the rest of a line after " ;" or " #".  Duplicate keys are numbered as in ProcessKVs.
+func ReadINI(specFile string) (KeyVal, error) {
+	handle, e := os.Open(specFile)
+	if e != nil {
+		return nil, e
+	}
+	defer func() { _ = handle.Close() }()
+
+	return readINI(handle, specFile)
+}
+
+// readINI reads the INI content of r.  specFile names r in errors.
+func readINI(r io.Reader, specFile string) (KeyVal, error) {
+	var keys, vals []string
+
+	prefix := ""
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.Trim(scanner.Text(), " \t\r")
+		if text == "" || text[0] == ';' || text[0] == '#' {
+			continue
+		}
+
+		for _, marker := range []string{" ;", "\t;", " #", "\t#"} {
+			if loc := strings.Index(text, marker); loc >= 0 {
+				text = strings.TrimRight(text[:loc], " \t")
+			}
+		}
+
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			prefix = ""
+			if section := strings.Trim(text[1:len(text)-1], " \t"); section != "" {
+				prefix = section + "."
+			}
+
+			continue
+		}
+
+		key, val, ok := strings.Cut(text, "=")
+		if key = strings.Trim(key, " \t"); !ok || key == "" {
+			return nil, &ParseError{File: specFile, Line: line, Text: text}
+		}
+
+		keys = append(keys, prefix+key)
+		vals = append(vals, strings.Trim(val, " \t"))
+	}
+
+	if e := scanner.Err(); e != nil {
+		return nil, e
+	}
+
+	return ProcessKVs(keys, vals)
+}
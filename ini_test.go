@@ -0,0 +1,44 @@
+package keyval
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadINI(t *testing.T) {
+	const content = `; global settings
+name = app
+
+[database]
+host = localhost ; the primary
+port=5432
+hosts = a, b
+
+# retries
+[retry]
+count = 3
+count = 5
+`
+	fileName := filepath.Join(t.TempDir(), "app.ini")
+	assert.Nil(t, os.WriteFile(fileName, []byte(content), 0644))
+
+	kv, err := ReadINI(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"name", "database.host", "database.port", "database.hosts", "retry.count1",
+		"retry.count2"}, kv.Keys())
+	assert.Equal(t, "localhost", kv.GetTrim("database.host"))
+	assert.Equal(t, 5432, *kv.Get("database.port").AsInt)
+	assert.Equal(t, []string{"a", "b"}, kv.Get("database.hosts").AsSliceS)
+	assert.Equal(t, []string{"3", "5"}, kv.GetMultipleTrim("retry.count"))
+	assert.Equal(t, 5432, *kv.Sub("database").Get("port").AsInt)
+
+	assert.Nil(t, os.WriteFile(fileName, []byte("[a]\nno delimiter\n"), 0644))
+	_, err = ReadINI(fileName)
+	assert.EqualError(t, err, "bad key val: no delimiter in file "+fileName+", line 2")
+
+	_, err = ReadINI(filepath.Join(t.TempDir(), "missing.ini"))
+	assert.NotNil(t, err)
+}
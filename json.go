@@ -0,0 +1,246 @@
+package keyval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarshalJSON emits kv as a JSON object mapping each key to its value in its BestType.  Dates are
+// formatted as RFC3339 and durations as strings such as "1m30s".  Duplicate keys are emitted as an array under their root key.
+func (kv KeyVal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(kv.jsonObject())
+}
+
+// ToJSON writes kv to w as an indented JSON object with the keys sorted.  The values are as in MarshalJSON.
+func (kv KeyVal) ToJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(kv.jsonObject())
+}
+
+// jsonObject returns kv as a map of each root key to its value, or values, in a form suitable for json.Marshal.
+func (kv KeyVal) jsonObject() map[string]any {
+	obj := make(map[string]any)
+	for k := range kv {
+		root := kv.rootKey(k)
+		if root == k {
+			obj[k] = jsonValue(kv[k])
+			continue
+		}
+
+		if _, ok := obj[root]; ok {
+			continue
+		}
+
+		var vals []any
+		for _, v := range kv.GetMultiple(root) {
+			vals = append(vals, jsonValue(v))
+		}
+
+		obj[root] = vals
+	}
+
+	return obj
+}
+
+// MarshalJSON emits v in its BestType as MarshalJSON of KeyVal does.
+func (v *Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonValue(v))
+}
+
+// UnmarshalJSON sets v to the Value Populate returns for the JSON scalar or array of scalars in data.  Arrays
+// are joined by ListDelim, so they become slices, and null gives an empty Value.  A string is a single string
+// even if it has ListDelim.
+func (v *Value) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var x any
+	if e := dec.Decode(&x); e != nil {
+		return e
+	}
+
+	str, ok := scalarString(x)
+	if arr, isArr := x.([]any); isArr {
+		var bad int
+		str, bad = joinLeaves(arr)
+		ok = bad == 0
+	}
+
+	if !ok {
+		return fmt.Errorf("json value %s is not a scalar or an array of scalars", data)
+	}
+
+	*v = *v.repopulate(str, Options{})
+
+	return nil
+}
+
+// jsonValue returns the element of v of its BestType in a form suitable for json.Marshal.
+func jsonValue(v *Value) any {
+	v.Resolve()
+	data, dt := bestOf(v)
+	switch dt {
+	case Date:
+		return v.AsDate.Format(time.RFC3339)
+	case SliceDate:
+		dts := make([]string, len(v.AsSliceD))
+		for ind, d := range v.AsSliceD {
+			dts[ind] = d.Format(time.RFC3339)
+		}
+
+		return dts
+	case Duration:
+		return v.AsDuration.String()
+	case SliceDuration:
+		durs := make([]string, len(v.AsSliceDur))
+		for ind, d := range v.AsSliceDur {
+			durs[ind] = d.String()
+		}
+
+		return durs
+	case Percent:
+		// keep the % so the value reads back as a percent
+		return strings.Trim(v.AsString, " \t")
+	case SlicePercent:
+		return v.AsSliceS
+	case Decimal:
+		// the digits as written, so there is no rounding
+		return json.Number(numString(v.AsString))
+	case Float:
+		// JSON has no NaN or infinity, so these are strings
+		if !isFinite(*v.AsFloat) {
+			return strings.Trim(v.AsString, " \t")
+		}
+	case SliceFloat:
+		for _, f := range v.AsSliceF {
+			if !isFinite(f) {
+				return v.AsSliceS
+			}
+		}
+	}
+
+	return data
+}
+
+// isFinite returns true if f is neither NaN nor an infinity.
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// FromJSON reads a JSON object from r and returns it as a KeyVal.  Nested objects are flattened: the key
+// "b" of the object under "a" becomes "a.b".  Arrays of numbers, strings and bools become slice values and
+// null becomes an empty value.  The leaves are converted by Populate, except that a string with ListDelim
+// stays a single string.
+func FromJSON(r io.Reader) (KeyVal, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var obj map[string]any
+	if e := dec.Decode(&obj); e != nil {
+		return nil, fmt.Errorf("reading json: %v", e)
+	}
+
+	return fromTree("json", obj)
+}
+
+// fromTree returns the KeyVal of the decoded object obj of the given format, flattening it as FromJSON does.
+func fromTree(format string, obj map[string]any) (KeyVal, error) {
+	var keys, vals []string
+	if e := flatten(format, "", obj, &keys, &vals); e != nil {
+		return nil, e
+	}
+
+	return ProcessKVs(keys, vals)
+}
+
+// flatten appends the leaves of obj to keys and vals in key order.  prefix is prepended to the keys.
+func flatten(format, prefix string, obj map[string]any, keys, vals *[]string) error {
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := prefix + name
+		switch x := obj[name].(type) {
+		case map[string]any:
+			if e := flatten(format, key+".", x, keys, vals); e != nil {
+				return e
+			}
+
+			continue
+		case []any:
+			str, bad := joinLeaves(x)
+			if bad > 0 {
+				return fmt.Errorf("element %d of %s array %s is not a number, string or bool", bad, format, key)
+			}
+
+			*keys, *vals = append(*keys, key), append(*vals, str)
+		default:
+			str, ok := scalarString(x)
+			if !ok {
+				return fmt.Errorf("%s value of %s is not supported", format, key)
+			}
+
+			*keys, *vals = append(*keys, key), append(*vals, str)
+		}
+	}
+
+	return nil
+}
+
+// joinLeaves returns the elements of arr joined by ListDelim.  If an element is not a scalar, bad is its
+// position, starting at 1.
+func joinLeaves(arr []any) (str string, bad int) {
+	elems := make([]string, len(arr))
+	for ind, elem := range arr {
+		var ok bool
+		if elems[ind], ok = leafString(elem); !ok {
+			return "", ind + 1
+		}
+	}
+
+	return strings.Join(elems, ListDelim), 0
+}
+
+// scalarString returns the scalar x as a string for Populate.  A string that has ListDelim, or that is itself
+// in double quotes, is quoted so Populate gives back the string rather than a slice.
+func scalarString(x any) (str string, ok bool) {
+	if s, isStr := x.(string); isStr {
+		if _, quoted := unquote(s); quoted || strings.Contains(s, ListDelim) {
+			return strconv.Quote(s), true
+		}
+	}
+
+	return leafString(x)
+}
+
+// leafString returns the scalar x as a string.  ok is false if x is an object, array or other unsupported type.
+func leafString(x any) (str string, ok bool) {
+	switch x := x.(type) {
+	case nil:
+		return "", true
+	case string:
+		return x, true
+	case json.Number:
+		return x.String(), true
+	case int, int64, uint64, bool:
+		return fmt.Sprint(x), true
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), true
+	case time.Time:
+		return formatDate(x), true
+	}
+
+	return "", false
+}
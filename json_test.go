@@ -0,0 +1,115 @@
+package keyval
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyVal_MarshalJSON(t *testing.T) {
+	keys := []string{"name", "port", "rate", "start", "hosts", "ports", "eqn", "eqn"}
+	vals := []string{"app", "8080", "0.5", "20230115", "a, b", "1,2", "a=b", "42"}
+
+	kv, err := ProcessKVs(keys, vals)
+	assert.Nil(t, err)
+
+	act, err := json.Marshal(kv)
+	assert.Nil(t, err)
+
+	exp := `{"eqn":["a=b",42],"hosts":["a","b"],"name":"app","port":8080,"ports":[1,2],"rate":0.5,` +
+		`"start":"2023-01-15T00:00:00Z"}`
+	assert.JSONEq(t, exp, string(act))
+
+	// JSON has no NaN or infinity, so these are strings
+	kv, err = ProcessKVs([]string{"nan", "inf", "rates"}, []string{"NaN", "-inf", "1.5, inf"})
+	assert.Nil(t, err)
+	assert.Equal(t, Float, kv.Get("nan").BestType)
+	act, err = json.Marshal(kv)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"nan":"NaN","inf":"-inf","rates":["1.5","inf"]}`, string(act))
+	assert.Nil(t, kv.ToJSON(&bytes.Buffer{}))
+}
+
+func TestKeyVal_ToJSON(t *testing.T) {
+	kv, err := ReadKVString("port: 8080\nhosts: a, b\nwait: 90s\n")
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, kv.ToJSON(&buf))
+	exp := "{\n  \"hosts\": [\n    \"a\",\n    \"b\"\n  ],\n  \"port\": 8080,\n  \"wait\": \"1m30s\"\n}\n"
+	assert.Equal(t, exp, buf.String())
+}
+
+func TestFromJSON(t *testing.T) {
+	kv, err := FromJSON(strings.NewReader(`{"name": "app", "db": {"port": 5432, "hosts": ["a", "b"],
+		"opts": {"ssl": true}}, "rates": [0.5, 1.5], "none": null, "title": "x, y", "quoted": "\"q\""}`))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"db.hosts", "db.opts.ssl", "db.port", "name", "none", "quoted", "rates", "title"},
+		kv.Keys())
+	assert.Equal(t, "x, y", kv.Get("title").AsString)
+	assert.Equal(t, String, kv.Get("title").BestType)
+	assert.Equal(t, `"q"`, kv.Get("quoted").AsString)
+	assert.Equal(t, 5432, *kv.Get("db.port").AsInt)
+	assert.Equal(t, []string{"a", "b"}, kv.Get("db.hosts").AsSliceS)
+	assert.True(t, *kv.Get("db.opts.ssl").AsBool)
+	assert.Equal(t, []float64{0.5, 1.5}, kv.Get("rates").AsSliceF)
+	assert.Equal(t, "", kv.Get("none").AsString)
+
+	_, err = FromJSON(strings.NewReader(`{"a": [1, {"b": 2}]}`))
+	assert.EqualError(t, err, "element 2 of json array a is not a number, string or bool")
+
+	_, err = FromJSON(strings.NewReader(`[1, 2]`))
+	assert.NotNil(t, err)
+}
+
+func TestValue_JSON(t *testing.T) {
+	type response struct {
+		Port  *Value `json:"port"`
+		Hosts *Value `json:"hosts"`
+		Start *Value `json:"start"`
+		Name  *Value `json:"name"`
+	}
+
+	resp := response{Port: Populate("8080"), Hosts: Populate("a, b"), Start: Populate("20230115"),
+		Name: Populate(`"x, y"`)}
+	act, err := json.Marshal(resp)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"port":8080,"hosts":["a","b"],"start":"2023-01-15T00:00:00Z","name":"x, y"}`, string(act))
+
+	var back response
+	assert.Nil(t, json.Unmarshal(act, &back))
+	for _, pair := range [][2]*Value{{resp.Port, back.Port}, {resp.Hosts, back.Hosts}, {resp.Start, back.Start},
+		{resp.Name, back.Name}} {
+		assert.Equal(t, pair[0].BestType, pair[1].BestType)
+		assert.Equal(t, pair[0].String(), pair[1].String())
+	}
+	assert.Equal(t, 8080, *back.Port.AsInt)
+	assert.Equal(t, []string{"a", "b"}, back.Hosts.AsSliceS)
+	assert.Equal(t, resp.Start.AsDate, back.Start.AsDate)
+	assert.Equal(t, "x, y", back.Name.AsString)
+	assert.Equal(t, String, back.Name.BestType)
+
+	v := &Value{}
+	assert.Nil(t, json.Unmarshal([]byte("[1, 2.5]"), v))
+	assert.Equal(t, []float64{1, 2.5}, v.AsSliceF)
+	assert.Nil(t, json.Unmarshal([]byte("null"), v))
+	assert.True(t, v.IsEmpty())
+	assert.EqualError(t, json.Unmarshal([]byte(`{"a": 1}`), v),
+		`json value {"a": 1} is not a scalar or an array of scalars`)
+
+	// percents keep their % so they read back as percents
+	act, err = json.Marshal(Populate("10%, 20%"))
+	assert.Nil(t, err)
+	assert.Equal(t, `["10%","20%"]`, string(act))
+	assert.Nil(t, json.Unmarshal(act, v))
+	assert.Equal(t, SlicePercent, v.BestType)
+
+	// decimals keep their digits
+	act, err = json.Marshal(populate("0.10", Options{Decimal: true}))
+	assert.Nil(t, err)
+	assert.Equal(t, "0.10", string(act))
+}
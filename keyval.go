@@ -8,28 +8,51 @@
 //
 //	<key>: <value(s)>
 //
-// When reading from a file, values can cross multiple lines in the file.
-// Both inline and standalone comments in the keyval file are supported. Comments use the Go // syntax.
+// When reading from a file, values can cross multiple lines in the file. A line that ends in \ is always
+// continued onto the next line, even if the next line has the key/value delimiter.
+// A block value keeps its line breaks: a value of <<TAG starts the block, which is ended by a line holding only
+// TAG.  The lines in between are taken as they are, including comments and indentation, and form a single string.
+// Both inline and standalone comments in the keyval file are supported. Comments use the Go // syntax by default;
+// another prefix, such as #, can be set with CommentPrefix in Options. An inline comment must be preceded by a
+// space and not be inside double quotes, so values such as http://host are not truncated.
 //
 // Values are stored in a struct that converts the value(s) into all the types the value supports. These can be:
 //   - string
 //   - int
 //   - float64
+//   - decimal (*big.Rat), if Decimal is set in Options
 //   - date (time.Time)
+//   - bool
+//   - duration (time.Duration), e.g. 30s or 2h45m
+//   - byte size (int64), e.g. 512MB or 2GiB
+//   - percent (float64 as a fraction), e.g. 75% is 0.75
 //   - []string
 //   - []int
 //   - []float64
 //   - []time.Time
+//   - []bool
+//   - []time.Duration
+//   - []percent ([]float64 as fractions)
 //
 // The struct includes a BestType field that is the "best" type
 // the value can be.  The order of precedence, in decreasing order, is:
 //   - date (time.Time)
 //   - int
+//   - decimal (*big.Rat), if Decimal is set in Options
 //   - float64
 //   - string
 //
 // Note that slices take precedence over unary types.
 //
+// A value in double quotes, e.g. "a, b", is a single string.  The escapes \n, \t, \" and \\ are supported.
+//
+// Booleans may be true/false, yes/no or on/off, in any case.
+//
+// Numbers may use underscores to separate digits, e.g. 1_000.  Numbers in scientific notation, e.g. 1e3, are
+// float64, not int.
+//
+// Keys may use dots to form sections, e.g. db.host and db.port.  Sub returns a section as a KeyVal.
+//
 // Duplicate keys are allowed. If duplicates are detected, a "count" is appended to the key, starting with "1".
 // Duplicates are numbered in the order they are found in the file.
 // The above can cause problems if you intend to have "key", "key" *and* another key called "key1" -- so beware.
@@ -39,7 +62,16 @@
 // to something else.
 //
 // There is one special key: include.  The value associated with this key is a file name.  The kevvals from
-// the specified file are loaded when the "include" key is encountered.
+// the specified file are loaded when the "include" key is encountered. If the file name has glob
+// characters (*, ?, [), all matching files are loaded in sorted order; a relative pattern is relative to the
+// directory of the file with the include.  Files can be opened from somewhere
+// other than the disk (e.g. an in-memory map) by setting IncludeResolver in Options and using ReadKVOpts, or
+// from an fs.FS, such as an embed.FS, with ReadKVFS.
+// An include may be an http or https URL if HTTPClient is set in Options.
+//
+// The key include-if loads a file only if a condition holds.  Its value is "condition, file", where the
+// condition is $VAR==value or key==value (or != for not equal).  $VAR is an environment variable and key is a
+// key defined before the include-if.  A condition of just $VAR or key holds if it has a non-empty value.
 //
 // There are functions to check whether required keys are present and whether extra keys are present.
 // There is also a validation function: CheckLegals.  See the example.
@@ -51,30 +83,288 @@
 //	"1/2/2006"
 //	"January 2, 2006"
 //	"Jan 2, 2006"
+//
+// Dates may include a time of day, for example:
+//
+//	"2006-01-02 15:04:05"
+//	"2006-01-02 15:04"
+//	"01/02/2006 15:04:05"
+//	"2006-01-02T15:04:05Z07:00" (RFC3339)
+//
+// Other layouts can be added for all parsing with RegisterDateFormat or for one Parser with DateFormats in Options.
 package keyval
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
+	"math/big"
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 )
 
+// These are the delimiters used by the package-level functions.  Changing them affects all goroutines;
+// use a Parser with its own Options to parse files with different delimiters concurrently.
 var (
-	KVDelim   = ":"  // KVDelim is the delimiter that separates the key from the value
+	KVDelim   = ":"  // KVDelim separates the key from the value. It may be several characters, e.g. "=>".
 	ListDelim = ","  // ListDelim separates list (slice) elements in the value.
 	LineEOL   = "\n" // FileEOF is the end-of-line character
 )
 
+// dateFormats holds the layouts added by RegisterDateFormat.
+var dateFormats struct {
+	mu      sync.RWMutex
+	layouts []string
+}
+
+// RegisterDateFormat adds layout, in the form used by time.Parse, to the date layouts tried when a value is
+// converted to a date.  Registered layouts are tried after the built-in ones, in the order registered, and
+// apply to all parsing.  Values already populated are not affected.
+func RegisterDateFormat(layout string) {
+	dateFormats.mu.Lock()
+	defer dateFormats.mu.Unlock()
+
+	for _, l := range dateFormats.layouts {
+		if l == layout {
+			return
+		}
+	}
+
+	dateFormats.layouts = append(dateFormats.layouts, layout)
+}
+
+// Options modifies how keyval files are read.  The zero value gives the default behavior.
+type Options struct {
+	// IncludeResolver, if not nil, is used instead of os.Open to open the top-level file and any include files.
+	// It can't list files, so an include with glob characters is passed to it as it is.
+	IncludeResolver func(name string) (io.ReadCloser, error)
+
+	// FS, if not nil and there is no IncludeResolver, is the file system the top-level file and any include
+	// files are read from.  Names are slash-separated paths within FS.  See ReadKVFS.
+	FS fs.FS
+
+	// CaseInsensitiveKeys lowercases the keys when they are processed, so "Port" and "port" are the same key.
+	// Get, GetMultiple, Missing, Present and Unknown then find these keys whatever the case of the key asked for.
+	CaseInsensitiveKeys bool
+
+	// CommentPrefix starts a comment.  The default is "//".
+	CommentPrefix string
+
+	// ResolveRefs replaces references of the form ${key} or %{key} in values with the value of key once all the
+	// keys are processed, so a key may be referenced before it is defined.  ${key:-default} and %{key:-default}
+	// give default if key is missing or empty.  A ${key} without a default whose key is missing is left as it
+	// is, so it can be expanded later, but a %{key} is an error, as is a cycle of references.
+	ResolveRefs bool
+
+	// ExpandEnv replaces ${VAR} in values with the environment variable VAR, or with the empty string if VAR is
+	// not set.  ${VAR:-default} gives default if VAR is not set or is empty.  If ResolveRefs is also set, a
+	// reference to a key takes precedence over the environment variable of the same name.
+	ExpandEnv bool
+
+	// Validators are run by CheckLegalsOpts on the Value of their key after the built-in checks.
+	Validators map[string]func(*Value) error
+
+	// KVDelim, ListDelim and LineEOL are used instead of the package variables of the same name if they are
+	// not empty.
+	KVDelim   string
+	ListDelim string
+	LineEOL   string
+
+	// DateFormats are layouts tried, after the built-in ones, when converting a value to a date.
+	DateFormats []string
+
+	// Duplicates says how duplicate keys are handled.  The default, DupNumber, numbers them.
+	Duplicates DuplicatePolicy
+
+	// HTTPClient, if not nil, is used to fetch includes that are http or https URLs.  Set its Timeout to limit
+	// how long a fetch may take.  Without it, such includes are an error.
+	HTTPClient *http.Client
+
+	// NormalizeKey, if not nil, is applied to each key read from a file instead of the default, StripSpaces.
+	// It is not applied to the special keys include and include-if.
+	NormalizeKey func(key string) string
+
+	// MaxIncludeDepth is the deepest that includes may be nested.  The default is 32.
+	MaxIncludeDepth int
+
+	// LazyPopulate defers the conversions of Populate for each Value until it is first used through Get,
+	// GetMultiple, Range or a method of the Value, or until Resolve is called.  Until then, a Value has only
+	// AsString and BestType String, so Values taken directly from the KeyVal map need Resolve before their other
+	// fields are read.  The conversions are done once, so concurrent reads through these are safe.
+	LazyPopulate bool
+
+	// Decimal populates AsDecimal, an exact *big.Rat, for numbers, so values such as prices do not suffer the
+	// rounding of float64.  A number that is not an int has BestType Decimal rather than Float.
+	Decimal bool
+
+	// ctx, if not nil, stops reading when it is done.  It is set by the Context functions, such as
+	// ReadKVContext.
+	ctx context.Context
+
+	// opened, if not nil, is called with the name of each file opened.  A Watcher uses it to find the files
+	// to watch.
+	opened func(name string)
+
+	// Warn, if not nil, is called by a Parser with each warning: keys renamed from an alias or deprecated name,
+	// other deprecated keys and violations of the legals with severity warn.
+	Warn func(warning string)
+}
+
+// defaultMaxIncludeDepth is the include depth allowed if MaxIncludeDepth is not set.
+const defaultMaxIncludeDepth = 32
+
+// DuplicatePolicy says how ProcessKVsOpts handles duplicate keys.
+type DuplicatePolicy int
+
+const (
+	DupNumber DuplicatePolicy = 0 + iota // DupNumber appends a count to duplicate keys: "key"1, "key"2, ...
+	DupFirst                             // DupFirst keeps the first value of the key
+	DupLast                              // DupLast keeps the last value of the key
+	DupError                             // DupError returns an error for a duplicate key
+)
+
+// open opens the file name using the IncludeResolver, if there is one.
+func (opts Options) open(name string) (io.ReadCloser, error) {
+	var (
+		rc io.ReadCloser
+		e  error
+	)
+
+	switch {
+	case opts.IncludeResolver != nil:
+		rc, e = opts.IncludeResolver(name)
+	case isURL(name):
+		rc, e = opts.fetch(strings.Trim(name, " "))
+	case opts.FS != nil:
+		rc, e = opts.FS.Open(name)
+	default:
+		rc, e = os.Open(name)
+	}
+
+	if e == nil && opts.opened != nil {
+		opts.opened(name)
+	}
+
+	return rc, e
+}
+
+// isURL returns true if name is an http or https URL.
+func isURL(name string) bool {
+	name = strings.TrimLeft(name, " ")
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// fetch gets url using the HTTPClient.
+func (opts Options) fetch(url string) (io.ReadCloser, error) {
+	if opts.HTTPClient == nil {
+		return nil, fmt.Errorf("include %s requires an HTTPClient in Options", url)
+	}
+
+	req, e := http.NewRequestWithContext(opts.context(), http.MethodGet, url, nil)
+	if e != nil {
+		return nil, e
+	}
+
+	resp, e := opts.HTTPClient.Do(req)
+	if e != nil {
+		return nil, e
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("include %s: %s", url, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// context returns the context of the read, which is context.Background if none was given.
+func (opts Options) context() context.Context {
+	if opts.ctx != nil {
+		return opts.ctx
+	}
+
+	return context.Background()
+}
+
+// commentPrefix returns the comment prefix to use.
+func (opts Options) commentPrefix() string {
+	if opts.CommentPrefix != "" {
+		return opts.CommentPrefix
+	}
+
+	return "//"
+}
+
+// normalizeKey applies the NormalizeKey hook, or StripSpaces if there isn't one, to key.
+func (opts Options) normalizeKey(key string) string {
+	if opts.NormalizeKey != nil {
+		return opts.NormalizeKey(key)
+	}
+
+	return StripSpaces(key)
+}
+
+// StripSpaces removes all the spaces from key.  It is how keys read from a file are normalized by default.
+func StripSpaces(key string) string {
+	return strings.ReplaceAll(key, " ", "")
+}
+
+// maxIncludeDepth returns the include depth allowed.
+func (opts Options) maxIncludeDepth() int {
+	if opts.MaxIncludeDepth > 0 {
+		return opts.MaxIncludeDepth
+	}
+
+	return defaultMaxIncludeDepth
+}
+
+// kvDelim returns the key/value delimiter to use.
+func (opts Options) kvDelim() string {
+	if opts.KVDelim != "" {
+		return opts.KVDelim
+	}
+
+	return KVDelim
+}
+
+// listDelim returns the slice delimiter to use.
+func (opts Options) listDelim() string {
+	if opts.ListDelim != "" {
+		return opts.ListDelim
+	}
+
+	return ListDelim
+}
+
+// lineEOL returns the end-of-line character to use.
+func (opts Options) lineEOL() string {
+	if opts.LineEOL != "" {
+		return opts.LineEOL
+	}
+
+	return LineEOL
+}
+
 // DataType is used to identify the "best" data type of the value.  The decreasing order of precedence is:
 //   - slices
 //   - unary types
 //
 // Within each of these types, the order is:
 //   - int
+//   - decimal, if Decimal is set in Options
 //   - float
 //   - string
 type DataType int
@@ -89,35 +379,398 @@ const (
 	SliceInt
 	SliceDate
 	InValid
+
+	// types added later follow InValid so the values above don't change
+	Bool
+	SliceBool
+	Duration
+	SliceDuration
+	ByteSize
+	Percent
+	SlicePercent
+	Decimal
 )
 
 //go:generate stringer -type=DataType
 
 // The Value struct holds the val part of the keyval.  All legal elements are populated.
 type Value struct {
-	AsString string
-	AsInt    *int
-	AsFloat  *float64
-	AsDate   *time.Time
-	AsSliceS []string
-	AsSliceI []int
-	AsSliceF []float64
-	AsSliceD []time.Time
-	BestType DataType
-}
-
-// KeyVal holds the map representation of the keyval file.
+	AsString   string
+	AsInt      *int
+	AsFloat    *float64
+	AsDecimal  *big.Rat
+	AsDate     *time.Time
+	AsBool     *bool
+	AsDuration *time.Duration
+	AsBytes    *int64
+	AsPercent  *float64
+	AsSliceS   []string
+	AsSliceI   []int
+	AsSliceF   []float64
+	AsSliceD   []time.Time
+	AsSliceB   []bool
+	AsSliceDur []time.Duration
+	AsSlicePct []float64
+	BestType   DataType
+
+	// Comment holds the comments above the key in the file and any inline comment on its lines, without the
+	// comment prefix and one per line.
+	Comment string
+
+	seq    int  // seq is the position, starting at 1, of the key in the keyval file; 0 if not from a file
+	folded bool // folded is true if the key was lower-cased by CaseInsensitiveKeys
+	quoted bool // quoted is true if the value was a double-quoted string
+
+	// root is the key of which the Value is a duplicate, if its key is root followed by its occurrence number
+	root string
+
+	// pending, if not nil, holds what a Value read with LazyPopulate needs to be resolved by Resolve
+	pending *lazyOpts
+}
+
+// lazyOpts are the Options used by the conversions of a Value read with LazyPopulate.  once makes sure the
+// conversions are done once, even if the Value is resolved by several goroutines.
+type lazyOpts struct {
+	listDelim   string
+	dateFormats []string
+	decimal     bool
+
+	once sync.Once
+}
+
+// Resolve does the conversions of Populate for a Value read with LazyPopulate, if they are not yet done, and
+// returns v.  Resolve does nothing to other Values.  Resolve is safe to call from concurrent goroutines.
+func (v *Value) Resolve() *Value {
+	if v == nil || v.pending == nil {
+		return v
+	}
+
+	// only the converted fields are set, so goroutines reading the others, such as pending, don't race
+	p := v.pending
+	p.once.Do(func() {
+		nv := populate(v.AsString, Options{ListDelim: p.listDelim, DateFormats: p.dateFormats, Decimal: p.decimal})
+		v.AsInt, v.AsFloat, v.AsDecimal, v.AsDate, v.AsBool = nv.AsInt, nv.AsFloat, nv.AsDecimal, nv.AsDate, nv.AsBool
+		v.AsDuration, v.AsBytes, v.AsPercent = nv.AsDuration, nv.AsBytes, nv.AsPercent
+		v.AsSliceS, v.AsSliceI, v.AsSliceF, v.AsSliceD = nv.AsSliceS, nv.AsSliceI, nv.AsSliceF, nv.AsSliceD
+		v.AsSliceB, v.AsSliceDur, v.AsSlicePct = nv.AsSliceB, nv.AsSliceDur, nv.AsSlicePct
+		v.BestType = nv.BestType
+	})
+
+	return v
+}
+
+// String returns the value in its BestType in a readable form.
+func (v *Value) String() string {
+	if v == nil {
+		return "<nil>"
+	}
+	v.Resolve()
+
+	switch v.BestType {
+	case Float:
+		return strconv.FormatFloat(*v.AsFloat, 'f', -1, 64)
+	case Int:
+		return strconv.Itoa(*v.AsInt)
+	case Date:
+		return formatDate(*v.AsDate)
+	case SliceStr:
+		return fmt.Sprint(v.AsSliceS)
+	case SliceFloat:
+		return fmt.Sprint(v.AsSliceF)
+	case SliceInt:
+		return fmt.Sprint(v.AsSliceI)
+	case SliceDate:
+		dts := make([]string, len(v.AsSliceD))
+		for ind, dt := range v.AsSliceD {
+			dts[ind] = formatDate(dt)
+		}
+
+		return fmt.Sprint(dts)
+	case Bool:
+		return strconv.FormatBool(*v.AsBool)
+	case SliceBool:
+		return fmt.Sprint(v.AsSliceB)
+	case Duration:
+		return v.AsDuration.String()
+	case SliceDuration:
+		return fmt.Sprint(v.AsSliceDur)
+	case ByteSize, Percent:
+		return strings.Trim(v.AsString, " \t")
+	case Decimal:
+		return numString(v.AsString)
+	case SlicePercent:
+		return fmt.Sprint(v.AsSliceS)
+	}
+
+	return v.AsString
+}
+
+// MarshalText returns the value as it would be written to a keyval file, so that UnmarshalText gives the
+// same Value.
+func (v *Value) MarshalText() ([]byte, error) {
+	return []byte(strings.Trim(writeValue(v, Options{}), " \t")), nil
+}
+
+// UnmarshalText sets v to the Value Populate returns for text.
+func (v *Value) UnmarshalText(text []byte) error {
+	*v = *v.repopulate(string(text), Options{})
+	return nil
+}
+
+// clone returns a deep copy of v.
+func (v *Value) clone() *Value {
+	c := *v.Resolve()
+	if v.AsInt != nil {
+		i := *v.AsInt
+		c.AsInt = &i
+	}
+
+	if v.AsFloat != nil {
+		f := *v.AsFloat
+		c.AsFloat = &f
+	}
+
+	if v.AsDate != nil {
+		d := *v.AsDate
+		c.AsDate = &d
+	}
+
+	if v.AsBool != nil {
+		b := *v.AsBool
+		c.AsBool = &b
+	}
+
+	if v.AsDuration != nil {
+		d := *v.AsDuration
+		c.AsDuration = &d
+	}
+
+	if v.AsBytes != nil {
+		b := *v.AsBytes
+		c.AsBytes = &b
+	}
+
+	if v.AsPercent != nil {
+		p := *v.AsPercent
+		c.AsPercent = &p
+	}
+
+	if v.AsDecimal != nil {
+		c.AsDecimal = new(big.Rat).Set(v.AsDecimal)
+	}
+
+	c.AsSliceS = append([]string(nil), v.AsSliceS...)
+	c.AsSliceI = append([]int(nil), v.AsSliceI...)
+	c.AsSliceF = append([]float64(nil), v.AsSliceF...)
+	c.AsSliceD = append([]time.Time(nil), v.AsSliceD...)
+	c.AsSliceB = append([]bool(nil), v.AsSliceB...)
+	c.AsSliceDur = append([]time.Duration(nil), v.AsSliceDur...)
+	c.AsSlicePct = append([]float64(nil), v.AsSlicePct...)
+
+	return &c
+}
+
+// AppendString appends s to the value as a new slice element and repopulates the value, so a unary value
+// becomes a slice.  s should not contain ListDelim.  A quoted string is kept as one element, so appending to
+// "a, b" gives the SliceStr ["a, b", s].  It returns v.
+func (v *Value) AppendString(s string) *Value {
+	str := s
+	if !v.IsEmpty() {
+		str = v.AsString + ListDelim + s
+	}
+
+	// elements that have ListDelim can't be split out of AsString again
+	var elems []string
+	if v.Resolve().quoted {
+		elems = []string{v.AsString}
+	}
+
+	for _, elem := range v.AsSliceS {
+		if strings.Contains(elem, ListDelim) {
+			elems = v.AsSliceS
+			break
+		}
+	}
+
+	*v = *v.repopulate(str, Options{})
+	if elems != nil {
+		elems = append(append([]string(nil), elems...), strings.Trim(s, " \t"))
+		*v = Value{AsString: v.AsString, AsSliceS: elems, BestType: SliceStr, Comment: v.Comment, seq: v.seq,
+			folded: v.folded, root: v.root}
+	}
+
+	return v
+}
+
+// repopulate returns a new Value populated from valStr that keeps v's place in the file, key processing and
+// comment.
+func (v *Value) repopulate(valStr string, opts Options) *Value {
+	nv := populate(valStr, opts)
+	nv.seq, nv.folded, nv.Comment, nv.root = v.seq, v.folded, v.Comment, v.root
+
+	return nv
+}
+
+// AppendInt appends i to the value.  See AppendString.
+func (v *Value) AppendInt(i int) *Value {
+	return v.AppendString(strconv.Itoa(i))
+}
+
+// AppendFloat appends f to the value.  See AppendString.
+func (v *Value) AppendFloat(f float64) *Value {
+	return v.AppendString(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// AppendDate appends dt to the value.  See AppendString.
+func (v *Value) AppendDate(dt time.Time) *Value {
+	return v.AppendString(formatDate(dt))
+}
+
+// IsEmpty returns true if the value is empty or has only spaces and tabs.  This distinguishes a key that
+// is present with no value ("key:") from a key that is absent.  A nil Value, as Get returns for a missing
+// key, is empty.
+func (v *Value) IsEmpty() bool {
+	if v == nil {
+		return true
+	}
+
+	return strings.Trim(v.AsString, " \t") == ""
+}
+
+// GetAs returns the element of v of type dt.  The element is returned as GetBest would return it.  An Int is
+// converted to a Float if AsFloat is not populated, likewise a SliceInt to a SliceFloat.
+// An error is returned if v cannot be represented as dt.
+func (v *Value) GetAs(dt DataType) (any, error) {
+	v.Resolve()
+	var data any
+	switch dt {
+	case String:
+		return v.AsString, nil
+	case Float:
+		if v.AsFloat == nil && v.AsInt != nil {
+			f := float64(*v.AsInt)
+			return &f, nil
+		}
+
+		if v.AsFloat != nil {
+			data = v.AsFloat
+		}
+	case Int:
+		if v.AsInt != nil {
+			data = v.AsInt
+		}
+	case Date:
+		if v.AsDate != nil {
+			data = v.AsDate
+		}
+	case SliceStr:
+		if v.AsSliceS != nil {
+			data = v.AsSliceS
+		}
+	case SliceFloat:
+		if v.AsSliceF == nil && v.AsSliceI != nil {
+			fs := make([]float64, len(v.AsSliceI))
+			for ind, i := range v.AsSliceI {
+				fs[ind] = float64(i)
+			}
+
+			return fs, nil
+		}
+
+		if v.AsSliceF != nil {
+			data = v.AsSliceF
+		}
+	case SliceInt:
+		if v.AsSliceI != nil {
+			data = v.AsSliceI
+		}
+	case SliceDate:
+		if v.AsSliceD != nil {
+			data = v.AsSliceD
+		}
+	case Bool:
+		if v.AsBool != nil {
+			data = v.AsBool
+		}
+	case SliceBool:
+		if v.AsSliceB != nil {
+			data = v.AsSliceB
+		}
+	case Duration:
+		if v.AsDuration != nil {
+			data = v.AsDuration
+		}
+	case SliceDuration:
+		if v.AsSliceDur != nil {
+			data = v.AsSliceDur
+		}
+	case ByteSize:
+		if v.AsBytes != nil {
+			data = v.AsBytes
+		}
+	case Percent:
+		if v.AsPercent != nil {
+			data = v.AsPercent
+		}
+	case SlicePercent:
+		if v.AsSlicePct != nil {
+			data = v.AsSlicePct
+		}
+	case Decimal:
+		if v.AsDecimal != nil {
+			data = v.AsDecimal
+		}
+	}
+
+	if data == nil {
+		return nil, fmt.Errorf("value cannot be represented as %v", dt)
+	}
+
+	return data, nil
+}
+
+// formatDate formats dt as YYYY-MM-DD if it has no time of day, otherwise as RFC3339.
+func formatDate(dt time.Time) string {
+	if dt.Equal(dt.Truncate(24 * time.Hour)) {
+		return dt.Format("2006-01-02")
+	}
+
+	return dt.Format(time.RFC3339)
+}
+
+// KeyVal holds the map representation of the keyval file.  Map iteration is unordered; use Keys or Range to
+// visit the keys in the order of the file.
+//
+// A KeyVal is safe for concurrent reads once it is built.  If it is modified while other goroutines read it,
+// use SafeKeyVal.
 type KeyVal map[string]*Value
 
 // Get returns a value. Nil is returned if the "want" DataType is not a legal type.
 func (kv KeyVal) Get(key string) *Value {
-	val, ok := kv[key]
+	val, ok := kv[kv.foldKey(key)]
 
 	if !ok {
 		return nil
 	}
 
-	return val
+	return val.Resolve()
+}
+
+// foldKey returns the lower case of key if key is not in kv but its lower case is, and was lower-cased
+// by CaseInsensitiveKeys.  Otherwise, key is returned.
+func (kv KeyVal) foldKey(key string) string {
+	if _, ok := kv[key]; ok {
+		return key
+	}
+
+	lower := strings.ToLower(key)
+	for _, k := range []string{lower, lower + "1"} {
+		if v, ok := kv[k]; ok && v.folded {
+			return lower
+		}
+	}
+
+	return key
 }
 
 // GetMultipleTrim returns a multiple key as a trimmed string slice
@@ -142,12 +795,30 @@ func (kv KeyVal) GetTrim(key string) string {
 
 // GetBest returns the Value element of the BestType along with what that type is.
 func (kv KeyVal) GetBest(key string) (data any, datatype DataType) {
-	val, ok := kv[key]
+	val, ok := kv[kv.foldKey(key)]
 
 	if !ok {
 		return nil, InValid
 	}
 
+	return bestOf(val)
+}
+
+// GetBestMultiple returns the Value element of the BestType along with what that type is for each of the
+// duplicate keys of root, in order.  See GetMultiple.
+func (kv KeyVal) GetBestMultiple(root string) (data []any, datatypes []DataType) {
+	for _, val := range kv.GetMultiple(root) {
+		d, dt := bestOf(val)
+		data = append(data, d)
+		datatypes = append(datatypes, dt)
+	}
+
+	return data, datatypes
+}
+
+// bestOf returns the element of val of its BestType along with the BestType.
+func bestOf(val *Value) (data any, datatype DataType) {
+	val.Resolve()
 	switch val.BestType {
 	case String:
 		return val.AsString, String
@@ -165,6 +836,22 @@ func (kv KeyVal) GetBest(key string) (data any, datatype DataType) {
 		return val.AsSliceI, SliceInt
 	case SliceDate:
 		return val.AsSliceD, SliceDate
+	case Bool:
+		return val.AsBool, Bool
+	case SliceBool:
+		return val.AsSliceB, SliceBool
+	case Duration:
+		return val.AsDuration, Duration
+	case SliceDuration:
+		return val.AsSliceDur, SliceDuration
+	case ByteSize:
+		return val.AsBytes, ByteSize
+	case Percent:
+		return val.AsPercent, Percent
+	case SlicePercent:
+		return val.AsSlicePct, SlicePercent
+	case Decimal:
+		return val.AsDecimal, Decimal
 	}
 
 	return nil, InValid
@@ -173,82 +860,258 @@ func (kv KeyVal) GetBest(key string) (data any, datatype DataType) {
 // GetMultiple retrieves all the Values that start with root that have duplicate keys. The actual keys would be
 // "root"1, "root"2, ....  The keys are returned in order.
 func (kv KeyVal) GetMultiple(root string) []*Value {
-	val := kv[root+"1"]
-	if val == nil {
-		if val = kv[root]; val != nil {
-			return []*Value{val}
-		}
-
-		return nil
+	var vals []*Value
+	for _, key := range kv.multipleKeys(root) {
+		vals = append(vals, kv[key].Resolve())
 	}
 
-	vals := []*Value{val}
-	ind := 2
+	return vals
+}
 
-	for {
-		val = kv[fmt.Sprintf("%s%d", root, ind)]
-		if val == nil {
-			return vals
-		}
-		vals = append(vals, val)
-		ind++
+// multipleKeys returns the keys of root as GetMultiple finds them: root itself if it is in kv, otherwise
+// "root"1, "root"2, ... if root has duplicates.  It returns nil if root is not in kv.
+func (kv KeyVal) multipleKeys(root string) []string {
+	root = kv.foldKey(root)
+	if _, ok := kv[root]; ok {
+		return []string{root}
 	}
-}
 
-// Missing returns a slice of needles that are not keys in kv.
-// needles is a comma-separated list of keys to look for.
-// returns nil if all needles are present.
-func (kv KeyVal) Missing(needles string) (missing []string) {
-	if needles == "" {
+	if _, ok := kv[root+"1"]; !ok {
 		return nil
 	}
 
-	needles = CleanString(needles, " \n\t")
-	for _, miss := range strings.Split(needles, ",") {
-		if kv.Get(miss) == nil && kv.GetMultiple(miss) == nil {
-			missing = append(missing, miss)
+	keys := []string{root + "1"}
+	for ind := 2; ; ind++ {
+		key := fmt.Sprintf("%s%d", root, ind)
+		if _, ok := kv[key]; !ok {
+			return keys
 		}
-	}
 
-	return missing
+		keys = append(keys, key)
+	}
 }
 
-// Present returns the keys in needles that are in kv.
-func (kv KeyVal) Present(needles string) (present []string) {
-	if needles == "" {
-		return nil
+// rootKey returns the root of key if key is a member of a set of duplicate keys, otherwise it returns key.  The
+// root is recorded on the Value when the duplicates are numbered, so keys that merely end in digits, such as
+// v1 and v2, are not taken as duplicates.
+func (kv KeyVal) rootKey(key string) string {
+	v := kv[key]
+	if v == nil || v.root == "" || !strings.HasPrefix(key, v.root) {
+		return key
 	}
 
-	needles = CleanString(needles, " \n\t")
-	for _, ndl := range strings.Split(needles, ListDelim) {
-		if kv.Get(ndl) != nil {
-			present = append(present, ndl)
-		}
+	if _, e := strconv.Atoi(key[len(v.root):]); e != nil {
+		return key
 	}
 
-	return present
+	return v.root
 }
 
-// Unknown returns the keys in kv that are not in universe.
-// universe is a comma-separated string that has the universe of known keys.
-// returns nil if all keys in kv are in universe.
-// Any entry in universe that ends in * is treated as a wildcard
-func (kv KeyVal) Unknown(universe string) (novel []string) {
-	if universe == "" {
-		return nil
-	}
+// MergePolicy says how Merge handles a key that is in both KeyVals.
+type MergePolicy int
 
-	// remove potential dreck
-	universe = CleanString(universe, " \n\t")
+const (
+	MergeKeep      MergePolicy = 0 + iota // MergeKeep keeps the Value of the receiver
+	MergeOverwrite                        // MergeOverwrite uses the Value of other
+	MergeAppend                           // MergeAppend keeps both, with other's Values as later duplicates
+)
 
-	univSlc := strings.Split(universe, ",")
-	for key := range kv {
-		found := false
+// Merge returns a new KeyVal with the keys of kv and other.  policy says what to do with a key in both.
+// Duplicate keys are merged as a set: with MergeOverwrite, all of other's "root"1, "root"2, ... replace all
+// of kv's; with MergeKeep, none of other's are added if kv has root.  With MergeAppend, other's Values follow
+// kv's and all are renumbered "root"1, "root"2, ....
+// The Values are not copied.
+func (kv KeyVal) Merge(other KeyVal, policy MergePolicy) KeyVal {
+	merged := make(KeyVal)
+	for k, v := range kv {
+		merged[k] = v
+	}
 
-		for _, uni := range univSlc {
-			if uni == key {
-				found = true
-				break
+	done := make(map[string]bool)
+	for k := range other {
+		root := other.rootKey(k)
+		if done[root] {
+			continue
+		}
+		done[root] = true
+
+		var vals []*Value
+		if kv.Missing(root) == nil {
+			switch policy {
+			case MergeKeep:
+				continue
+			case MergeAppend:
+				vals = kv.GetMultiple(root)
+			}
+
+			for _, key := range kv.multipleKeys(root) {
+				delete(merged, key)
+			}
+		}
+
+		vals = append(vals, other.GetMultiple(root)...)
+		if len(vals) == 1 {
+			merged[root] = vals[0]
+			continue
+		}
+
+		for ind, v := range vals {
+			v.root = root
+			merged[fmt.Sprintf("%s%d", root, ind+1)] = v
+		}
+	}
+
+	return merged
+}
+
+// Subset returns a new KeyVal with the keys of kv that start with prefix.  If strip is true, prefix is
+// removed from the keys.  The Values are copied, so the Subset is independent of kv.
+func (kv KeyVal) Subset(prefix string, strip bool) KeyVal {
+	sub := make(KeyVal)
+	for k, v := range kv {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+
+		c := v.clone()
+		if strip {
+			k, c.root = k[len(prefix):], strings.TrimPrefix(c.root, prefix)
+		}
+
+		sub[k] = c
+	}
+
+	return sub
+}
+
+// Keys returns the keys of kv in the order they were in the keyval file or the slices given to ProcessKVs.
+// Keys added to kv directly come last, sorted.
+func (kv KeyVal) Keys() []string {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		si, sj := kv[keys[i]].seq, kv[keys[j]].seq
+		if si != sj && si != 0 && sj != 0 {
+			return si < sj
+		}
+
+		if (si == 0) != (sj == 0) {
+			return sj == 0
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+// Range calls f for each key and Value of kv in the order of Keys.  Range stops if f returns false.
+func (kv KeyVal) Range(f func(key string, val *Value) bool) {
+	for _, k := range kv.Keys() {
+		if !f(k, kv[k].Resolve()) {
+			return
+		}
+	}
+}
+
+// Clone returns a deep copy of kv.  The Values, including their slices, are copied, so changing the copy does not
+// change kv.
+func (kv KeyVal) Clone() KeyVal {
+	if kv == nil {
+		return nil
+	}
+
+	c := make(KeyVal, len(kv))
+	for k, v := range kv {
+		c[k] = v.clone()
+	}
+
+	return c
+}
+
+// Sub returns the section of kv named section: the keys of the form section.name, with "section." removed.
+// Sections may be nested, so kv.Sub("db").Sub("primary") is kv.Sub("db.primary").  See Subset.
+func (kv KeyVal) Sub(section string) KeyVal {
+	return kv.Subset(section+".", true)
+}
+
+// TypeHistogram returns the number of values in kv of each BestType.  Each member of a set of duplicate keys
+// is counted separately.
+func (kv KeyVal) TypeHistogram() map[DataType]int {
+	hist := make(map[DataType]int)
+	for _, v := range kv {
+		hist[v.Resolve().BestType]++
+	}
+
+	return hist
+}
+
+// Missing returns a slice of needles that are not keys in kv.
+// needles is a comma-separated list of keys to look for.
+// returns nil if all needles are present.
+func (kv KeyVal) Missing(needles string) (missing []string) {
+	if needles == "" {
+		return nil
+	}
+
+	needles = CleanString(needles, " \n\t")
+	for _, miss := range strings.Split(needles, ",") {
+		if kv.Get(miss) == nil && kv.GetMultiple(miss) == nil {
+			missing = append(missing, miss)
+		}
+	}
+
+	return missing
+}
+
+// Present returns the keys in needles that are in kv.
+func (kv KeyVal) Present(needles string) (present []string) {
+	if needles == "" {
+		return nil
+	}
+
+	needles = CleanString(needles, " \n\t")
+	for _, ndl := range strings.Split(needles, ListDelim) {
+		if kv.Get(ndl) != nil {
+			present = append(present, ndl)
+		}
+	}
+
+	return present
+}
+
+// Unknown returns the keys in kv that are not in universe.
+// universe is a comma-separated string that has the universe of known keys.
+// returns nil if all keys in kv are in universe.
+// Any entry in universe that ends in * is treated as a wildcard
+func (kv KeyVal) Unknown(universe string) (novel []string) {
+	if universe == "" {
+		return nil
+	}
+
+	// remove potential dreck
+	universe = CleanString(universe, " \n\t")
+
+	univSlc := strings.Split(universe, ",")
+	for key := range kv {
+		found := false
+
+		for _, uni := range univSlc {
+			// stray commas produce empty entries
+			if uni == "" {
+				continue
+			}
+
+			if kv[key].folded {
+				uni = strings.ToLower(uni)
+			}
+
+			if uni == key {
+				found = true
+				break
 			}
 
 			if uni[len(uni)-1] == '*' {
@@ -270,361 +1133,1916 @@ func (kv KeyVal) Unknown(universe string) (novel []string) {
 // ReadKV2Slc reads the specFile and returns the key/vals as two slices of strings.
 // These can be processed into a KeyVal by ProcessKVs.
 func ReadKV2Slc(specFile string) (keys, vals []string, err error) {
-	handle, e := os.Open(specFile)
+	return ReadKV2SlcOpts(specFile, Options{})
+}
+
+// ReadKV2SlcOpts is ReadKV2Slc with the reading modified by opts.
+func ReadKV2SlcOpts(specFile string, opts Options) (keys, vals []string, err error) {
+	keys, vals, _, err = readKV2SlcFile(specFile, opts, nil)
+	return keys, vals, err
+}
+
+// readKV2SlcFile opens and reads specFile.  stack holds the files that include specFile, outermost first.
+func readKV2SlcFile(specFile string, opts Options, stack []string) (keys, vals, comments []string, err error) {
+	chain := append(append([]string(nil), stack...), specFile)
+	for _, file := range stack {
+		if filepath.Clean(file) == filepath.Clean(specFile) {
+			return nil, nil, nil, fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	if len(stack) > opts.maxIncludeDepth() {
+		return nil, nil, nil, fmt.Errorf("include depth exceeds %d: %s", opts.maxIncludeDepth(), strings.Join(chain, " -> "))
+	}
+
+	if e := opts.context().Err(); e != nil {
+		return nil, nil, nil, e
+	}
+
+	handle, e := opts.open(specFile)
 	if e != nil {
-		return nil, nil, e
+		return nil, nil, nil, e
 	}
 	defer func() { _ = handle.Close() }()
 
-	rdr := bufio.NewReader(handle)
+	return readKV2Slc(handle, specFile, opts, stack)
+}
+
+// readKV2Slc reads the key/vals from handle, along with the comment of each.  specFile is the name of the source
+// used in errors and stack holds the files that include it.
+func readKV2Slc(handle io.Reader, specFile string, opts Options, stack []string) (keys, vals, comments []string,
+	err error) {
+	// addEntry splits entry, which starts on line entryLine, into key and val and adds these and comment to keys,
+	// vals and comments.
+	addEntry := func(entry string, entryLine int, comment string) error {
+		kvSlice := strings.SplitN(entry, opts.kvDelim(), 2)
+		if len(kvSlice) != 2 {
+			return &ParseError{File: specFile, Line: entryLine, Text: strings.Trim(entry, " ")}
+		}
+
+		key := StripSpaces(kvSlice[0])
+		val := strings.TrimLeft(kvSlice[1], " ")
+
+		// include-if is an include that depends on a condition
+		if key == "include-if" {
+			cond, file, ok := strings.Cut(val, ",")
+			if !ok {
+				return &ParseError{File: specFile, Line: entryLine, Text: strings.Trim(entry, " ")}
+			}
+
+			if !includeCondition(strings.Trim(cond, " \t"), keys, vals) {
+				return nil
+			}
+
+			key, val = "include", strings.TrimLeft(file, " \t")
+		}
+
+		if key == "include" {
+			files := []string{val}
+			// a resolver can't list files, so it is given the pattern
+			if strings.ContainsAny(val, "*?[") && !isURL(val) && opts.IncludeResolver == nil {
+				var e error
+				if files, e = globInclude(strings.Trim(val, " "), specFile, opts); e != nil {
+					return e
+				}
+			}
+
+			for _, file := range files {
+				ks, vs, cs, e := readKV2SlcFile(file, opts, append(stack, specFile))
+				if e != nil {
+					return e
+				}
+
+				keys = append(keys, ks...)
+				vals = append(vals, vs...)
+				comments = append(comments, cs...)
+			}
+
+			return nil
+		}
+
+		keys = append(keys, opts.normalizeKey(kvSlice[0]))
+		vals = append(vals, val)
+		comments = append(comments, comment)
+
+		return nil
+	}
+
+	er := newEntryReader(handle, specFile, opts)
+	for {
+		entry, entryLine, comment, e := er.next()
+		if e == io.EOF {
+			return keys, vals, comments, nil
+		}
+
+		if e != nil {
+			return nil, nil, nil, e
+		}
+
+		if e := addEntry(entry, entryLine, comment); e != nil {
+			return nil, nil, nil, e
+		}
+	}
+}
+
+// entryReader splits a keyval file into entries: a key and its value, which may span several lines, along
+// with the comment of the entry.
+type entryReader struct {
+	rdr      *bufio.Reader
+	specFile string
+	opts     Options
 
 	// must keep track of multiple lines since values can occupy multiple lines.
-	line, nextLine := "", ""
-	done := 0 // done==2: processing ends; done==1: hit EOF, but it occurs on a populated line so will do 1 more loop.
+	entry             string
+	continued         bool     // the previous line ended with an explicit continuation
+	lineNo, entryLine int      // the current line and the line on which entry starts
+	tag               string   // the tag ending the block value being read, if any
+	block             []string // the lines of the block value
+	comment           []string // the comment of entry
+	pending           []string // the comment lines since entry started, which belong to the next entry
+	eof, done         bool
+}
+
+// newEntryReader returns an entryReader for handle.  specFile is the name of the source used in errors.
+func newEntryReader(handle io.Reader, specFile string, opts Options) *entryReader {
+	return &entryReader{rdr: bufio.NewReader(handle), specFile: specFile, opts: opts}
+}
+
+// next returns the next entry, the line on which it starts and its comment.  The last entry is returned even
+// if it is empty.  After it, err is io.EOF.
+func (er *entryReader) next() (entry string, entryLine int, comment string, err error) {
+	opts := er.opts
+	for !er.eof {
+		if e := opts.context().Err(); e != nil {
+			return "", 0, "", e
+		}
+
+		line, e := er.rdr.ReadString(opts.lineEOL()[0])
+		if e != nil && e != io.EOF {
+			return "", 0, "", e
+		}
+		er.eof = e == io.EOF
+		er.lineNo++
+
+		// lines of a block value are taken as is until the line with the tag
+		if er.tag != "" {
+			line = strings.TrimRight(line, opts.lineEOL())
+			if strings.Trim(line, " \t") != er.tag {
+				er.block = append(er.block, line)
+				continue
+			}
+
+			// store the block quoted so it populates as a single string
+			key := strings.SplitN(er.entry, opts.kvDelim(), 2)[0]
+			er.entry = fmt.Sprintf("%s%s %s", key, opts.kvDelim(), strconv.Quote(strings.Join(er.block, "\n")))
+			er.tag, er.block = "", nil
+			continue
+		}
+
+		line = strings.TrimLeft(strings.TrimRight(line, opts.lineEOL()), " ")
+
+		// lines must be at least 2 characters
+		if line == "" || len(line) < 2 {
+			continue
+		}
+
+		// entire line is a comment
+		if strings.HasPrefix(line, opts.commentPrefix()) {
+			er.pending = append(er.pending, strings.Trim(line[len(opts.commentPrefix()):], " \t"))
+			continue
+		}
+
+		// line has comment
+		inline := ""
+		if ind := commentIndex(line, opts.commentPrefix()); ind >= 0 {
+			inline = strings.Trim(line[ind+len(opts.commentPrefix()):], " \t")
+			line = line[0:ind]
+			line = strings.TrimRight(line, " ")
+		}
+
+		// a trailing \ means the value continues on the next line
+		cont := false
+		if trimmed := strings.TrimRight(line, " "); strings.HasSuffix(trimmed, `\`) {
+			line, cont = strings.TrimRight(trimmed[:len(trimmed)-1], " "), true
+		}
+
+		// are these separate entries?
+		complete := false
+		if !er.continued && strings.Contains(er.entry, opts.kvDelim()) && strings.Contains(line, opts.kvDelim()) {
+			entry, entryLine, comment, complete = er.entry, er.entryLine, strings.Join(er.comment, "\n"), true
+
+			er.entry, er.entryLine = line, er.lineNo
+			er.comment, er.pending = er.pending, nil
+		} else {
+			if er.entry == "" {
+				er.entryLine = er.lineNo
+				er.comment, er.pending = er.pending, nil
+			}
+
+			// append and keep reading
+			er.entry = fmt.Sprintf("%s %s", er.entry, line)
+		}
+
+		if inline != "" {
+			er.comment = append(er.comment, inline)
+		}
+
+		er.continued = cont
+
+		// a value of <<TAG starts a block value
+		if er.entryLine == er.lineNo && !cont {
+			er.tag = blockTag(line, opts.kvDelim())
+		}
+
+		if complete {
+			return entry, entryLine, comment, nil
+		}
+	}
+
+	if er.done {
+		return "", 0, "", io.EOF
+	}
+	er.done = true
+
+	if er.tag != "" {
+		return "", 0, "", &ParseError{File: er.specFile, Line: er.entryLine,
+			Text: fmt.Sprintf("block %s is not ended", er.tag)}
+	}
+
+	return er.entry, er.entryLine, strings.Join(er.comment, "\n"), nil
+}
+
+// includeCondition returns true if the condition of an include-if holds.  The condition has one of the forms
+//
+//	name
+//	name==value
+//	name!=value
+//
+// where name is $VAR for the environment variable VAR or else a key read before the include-if.  The first form
+// holds if name is set to a non-empty value.
+func includeCondition(cond string, keys, vals []string) bool {
+	name, want, op := cond, "", ""
+	for _, o := range []string{"==", "!="} {
+		if parts := strings.SplitN(cond, o, 2); len(parts) == 2 {
+			name, want, op = strings.Trim(parts[0], " \t"), strings.Trim(parts[1], " \t"), o
+			break
+		}
+	}
+
+	have, found := "", false
+	if strings.HasPrefix(name, "$") {
+		have, found = os.LookupEnv(name[1:])
+	} else {
+		// the last value of the key is the current one
+		for ind := len(keys) - 1; ind >= 0; ind-- {
+			if keys[ind] == name {
+				have, found = strings.Trim(vals[ind], " \t"), true
+				break
+			}
+		}
+	}
+
+	switch op {
+	case "==":
+		return found && have == want
+	case "!=":
+		return !found || have != want
+	}
+
+	return found && have != ""
+}
+
+// blockTag returns the tag if the value in line is <<tag, which starts a block value.
+func blockTag(line, kvDelim string) string {
+	kvSlice := strings.SplitN(line, kvDelim, 2)
+	if len(kvSlice) != 2 {
+		return ""
+	}
+
+	val := strings.Trim(kvSlice[1], " \t")
+	if !strings.HasPrefix(val, "<<") || len(val) == 2 || strings.ContainsAny(val, " \t") {
+		return ""
+	}
+
+	return val[2:]
+}
+
+// ParseError is returned when a line of a keyval file cannot be parsed.
+type ParseError struct {
+	File string // File is the file with the error, which may be an include file
+	Line int    // Line is the line number, starting at 1, on which the bad entry starts
+	Text string // Text is the bad entry
+}
+
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf("bad key val: %s in file %s, line %d", pe.Text, pe.File, pe.Line)
+}
+
+// globInclude returns the files that match pattern in sorted order.  A relative pattern is relative to the
+// directory of specFile, the file with the include.  With FS set, the files are those in FS.
+func globInclude(pattern, specFile string, opts Options) ([]string, error) {
+	var (
+		files []string
+		e     error
+	)
+
+	if opts.FS != nil {
+		pattern = path.Join(path.Dir(specFile), pattern)
+		files, e = fs.Glob(opts.FS, pattern)
+	} else {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(specFile), pattern)
+		}
+
+		files, e = filepath.Glob(pattern)
+	}
+
+	if e != nil {
+		return nil, e
+	}
+
+	if files == nil {
+		return nil, fmt.Errorf("include %s in file %s matches no files", pattern, specFile)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// commentIndex returns the location of an inline comment starting with prefix in line, -1 if there is none.
+// The comment must be preceded by a space or tab so that values like "http://host" are not treated as comments.
+// A prefix within double quotes does not start a comment.
+func commentIndex(line, prefix string) int {
+	quoted := false
+	for ind := 0; ind < len(line); ind++ {
+		switch {
+		case line[ind] == '"' && (ind == 0 || line[ind-1] != '\\'):
+			quoted = !quoted
+		case quoted || !strings.HasPrefix(line[ind:], prefix):
+			continue
+		case ind == 0 || line[ind-1] == ' ' || line[ind-1] == '\t':
+			return ind
+		}
+	}
+
+	return -1
+}
+
+// ProcessKVs process keys and vals as two slices of string.  It returns a KeyVal.
+func ProcessKVs(keys, vals []string) (kv KeyVal, err error) {
+	return ProcessKVsOpts(keys, vals, Options{})
+}
+
+// ProcessKVsOpts is ProcessKVs with the processing modified by opts.
+func ProcessKVsOpts(keys, vals []string, opts Options) (kv KeyVal, err error) {
+	return processKVs(keys, vals, nil, opts)
+}
+
+// processKVs is ProcessKVsOpts that also sets the comment of each value if comments is not nil.
+func processKVs(keys, vals, comments []string, opts Options) (kv KeyVal, err error) {
+	if keys == nil || vals == nil {
+		return nil, fmt.Errorf("nil slice passes to ProcessKVs")
+	}
+
+	if len(keys) != len(vals) {
+		return nil, fmt.Errorf("slices not same length in ProcessKVs")
+	}
+
+	// newVal populates the value at index indx
+	newVal := func(indx int) *Value {
+		v := populate(vals[indx], opts)
+		v.seq, v.folded = indx+1, opts.CaseInsensitiveKeys
+		if comments != nil {
+			v.Comment = comments[indx]
+		}
+
+		return v
+	}
+
+	kv = make(KeyVal)
+	for indx := 0; indx < len(keys); indx++ {
+		// spaces mean nothing
+		base := keys[indx]
+		if opts.CaseInsensitiveKeys {
+			base = strings.ToLower(base)
+		}
+
+		if _, dup := kv[base]; opts.Duplicates != DupNumber && dup {
+			switch opts.Duplicates {
+			case DupFirst:
+				continue
+			case DupError:
+				return nil, fmt.Errorf("duplicate key %s", base)
+			}
+		}
+
+		if opts.Duplicates != DupNumber {
+			kv[base] = newVal(indx)
+			continue
+		}
+
+		// now we test to see if this key is a duplicate
+		key, keyTest := base, base
+
+		// if key isn't there but if it's a duplicate, the first entry might already have had "1" appended.
+		if _, ok := kv[base]; !ok {
+			keyTest = base + "1"
+		}
+
+		// look for duplicates and stop when we run out
+		ind := 1
+		for _, ok := kv[keyTest]; ok; _, ok = kv[keyTest] {
+			ind++
+			keyTest = fmt.Sprintf("%s%d", base, ind)
+			key = keyTest
+		}
+
+		// In this case, we have a duplicate but this is the first dup.  In that case, append a "1" to the first
+		// instance and drop the original.
+		if ind == 2 {
+			kv[base+"1"] = kv[base]
+			kv[base+"1"].root = base
+			delete(kv, base)
+		}
+
+		kv[key] = newVal(indx)
+		if ind > 1 {
+			kv[key].root = base
+		}
+	}
+
+	if opts.ExpandEnv {
+		expandEnv(kv, opts)
+	}
+
+	if opts.ResolveRefs {
+		if e := resolveRefs(kv, opts); e != nil {
+			return nil, e
+		}
+	}
+
+	return kv, nil
+}
+
+// envRx finds references to environment variables, with an optional default, in a value.
+var envRx = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces the references to environment variables in the values of kv.  If opts.ResolveRefs is set,
+// references to keys are left for resolveRefs.
+func expandEnv(kv KeyVal, opts Options) {
+	for k, v := range kv {
+		val := envRx.ReplaceAllStringFunc(v.AsString, func(ref string) string {
+			match := envRx.FindStringSubmatch(ref)
+			if _, isKey := kv[match[1]]; isKey && opts.ResolveRefs {
+				return ref
+			}
+
+			env, ok := os.LookupEnv(match[1])
+			if match[2] != "" && (!ok || env == "") {
+				return match[3]
+			}
+
+			return env
+		})
+
+		if val != v.AsString {
+			kv[k] = v.repopulate(val, opts)
+		}
+	}
+}
+
+// refRx finds references to other keys in a value, with an optional :-default.
+var refRx = regexp.MustCompile(`([$%])\{([^}]*?)(:-([^}]*))?\}`)
+
+// resolveRefs replaces references of the form ${key} or %{key} in the values of kv with the value of key.  See
+// Options.ResolveRefs.
+func resolveRefs(kv KeyVal, opts Options) error {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	resolved := make(map[string]bool)
+
+	var resolve func(key string, stack []string) error
+	resolve = func(key string, stack []string) error {
+		if resolved[key] {
+			return nil
+		}
+
+		if searchSlice(key, stack) >= 0 {
+			return fmt.Errorf("reference cycle: %s", strings.Join(append(stack, key), " -> "))
+		}
+		stack = append(stack, key)
+
+		val := kv[key].AsString
+		for _, match := range refRx.FindAllStringSubmatch(val, -1) {
+			ref, hasDefault := match[2], match[3] != ""
+			if ref == "" {
+				continue
+			}
+
+			if _, ok := kv[ref]; !ok {
+				switch {
+				case hasDefault:
+					val = strings.ReplaceAll(val, match[0], match[4])
+				case match[1] == "%":
+					return newKeyError(ErrMissingKey, ref, "", "", fmt.Sprintf("key %s references missing key %s", key, ref))
+				}
+
+				continue
+			}
+
+			if e := resolve(ref, stack); e != nil {
+				return e
+			}
+
+			refVal := strings.Trim(kv[ref].AsString, " ")
+			if hasDefault && refVal == "" {
+				refVal = match[4]
+			}
+
+			val = strings.ReplaceAll(val, match[0], refVal)
+		}
+
+		if val != kv[key].AsString {
+			kv[key] = kv[key].repopulate(val, opts)
+		}
+		resolved[key] = true
+
+		return nil
+	}
+
+	for _, k := range keys {
+		if e := resolve(k, nil); e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// ReadKV reads a key/val set from specFile and returns KeyVal
+func ReadKV(specFile string) (keyval KeyVal, err error) {
+	return ReadKVOpts(specFile, Options{})
+}
+
+// ReadKVContext is ReadKV that stops, returning the error of ctx, when ctx is done.  ctx is also used for
+// includes that are URLs.
+func ReadKVContext(ctx context.Context, specFile string) (keyval KeyVal, err error) {
+	return ReadKVOptsContext(ctx, specFile, Options{})
+}
+
+// ReadKVOptsContext is ReadKVOpts that stops when ctx is done.  See ReadKVContext.
+func ReadKVOptsContext(ctx context.Context, specFile string, opts Options) (keyval KeyVal, err error) {
+	opts.ctx = ctx
+	return ReadKVOpts(specFile, opts)
+}
+
+// ReadKVFS reads the keyval file name from fsys, along with its includes.  name and the includes are
+// slash-separated paths within fsys.
+func ReadKVFS(fsys fs.FS, name string) (keyval KeyVal, err error) {
+	return ReadKVOpts(name, Options{FS: fsys})
+}
+
+// ReadKVOpts is ReadKV with the reading modified by opts.
+func ReadKVOpts(specFile string, opts Options) (keyval KeyVal, err error) {
+	keys, vals, comments, e := readKV2SlcFile(specFile, opts, nil)
+	if e != nil {
+		return keyval, e
+	}
+
+	return processKVs(keys, vals, comments, opts)
+}
+
+// ReadKV2SlcFromReader reads the key/vals from r and returns them as two slices of strings.
+// Include files are opened relative to the current working directory.
+func ReadKV2SlcFromReader(r io.Reader) (keys, vals []string, err error) {
+	keys, vals, _, err = readKV2Slc(r, "<reader>", Options{}, nil)
+	return keys, vals, err
+}
+
+// ReadKVFromReader reads a key/val set from r and returns KeyVal.  The format is the same as a file read
+// by ReadKV.  Include files are opened relative to the current working directory.
+func ReadKVFromReader(r io.Reader) (keyval KeyVal, err error) {
+	keys, vals, comments, e := readKV2Slc(r, "<reader>", Options{}, nil)
+	if e != nil {
+		return keyval, e
+	}
+
+	return processKVs(keys, vals, comments, Options{})
+}
+
+// ReadKVString reads a key/val set from content, which has the same format as a file read by ReadKV.
+// Include files are opened relative to the current working directory.
+func ReadKVString(content string) (keyval KeyVal, err error) {
+	keys, vals, comments, e := readKV2Slc(strings.NewReader(content), "<string>", Options{}, nil)
+	if e != nil {
+		return keyval, e
+	}
+
+	return processKVs(keys, vals, comments, Options{})
+}
+
+// ParseString is ReadKVString.  It matches Parser.ParseString for keyvals that don't need to be validated.
+func ParseString(content string) (KeyVal, error) {
+	return ReadKVString(content)
+}
+
+// toDate attempts to convert inStr to time.Time
+func toDate(inStr string) *time.Time {
+	return toDateFmts(inStr, nil)
+}
+
+// toDateFmts attempts to convert inStr to time.Time using the built-in layouts, the registered layouts and then
+// the layouts in extra.
+func toDateFmts(inStr string, extra []string) *time.Time {
+	fmts := []string{"2006-01-02", "2006-1-2", "2006/01/02", "2006/1/2", "20060102", "01022006",
+		"01/02/2006", "1/2/2006", "01-02-2006", "1-2-2006", "200601", "Jan 2 2006", "January 2 2006",
+		"Jan 2, 2006", "January 2, 2006", time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05",
+		"2006-01-02 15:04", "01/02/2006 15:04:05", "1/2/2006 15:04:05", "01/02/2006 15:04", "1/2/2006 15:04"}
+	trim := strings.TrimRight(strings.TrimLeft(inStr, " "), " ")
+	dateFormats.mu.RLock()
+	fmts = append(fmts, dateFormats.layouts...)
+	dateFormats.mu.RUnlock()
+
+	for _, fm := range append(fmts, extra...) {
+		dt, err := time.Parse(fm, trim)
+		if err == nil {
+			return &dt
+		}
+	}
+
+	return nil
+}
+
+// Populate populates all the legal values that valStr can accommodate.  The AsString field is always populated.
+// The BestType is set using the order of precedence described under the type DataType.
+//
+// An empty value (one with only spaces or tabs) has only the AsString field populated.  See IsEmpty.
+//
+// A value in double quotes is a single string: AsString is the value without the quotes and with the escapes
+// \n, \t, \" and \\ replaced.  No other fields are populated, so a quoted value may contain ListDelim.
+func Populate(valStr string) *Value {
+	return populate(valStr, Options{})
+}
+
+// populate is Populate using the ListDelim and DateFormats of opts.
+func populate(valStr string, opts Options) *Value {
+	val := &Value{AsString: valStr, BestType: String}
+	if val.IsEmpty() {
+		return val
+	}
+
+	if str, ok := unquote(valStr); ok {
+		val.AsString, val.quoted = str, true
+		return val
+	}
+
+	if opts.LazyPopulate {
+		val.pending = &lazyOpts{listDelim: opts.listDelim(), dateFormats: opts.DateFormats, decimal: opts.Decimal}
+		return val
+	}
+
+	if valFloat, e := strconv.ParseFloat(numString(valStr), 64); e == nil {
+		toFloat := valFloat
+		val.AsFloat = &toFloat
+		val.BestType = Float
+	}
+
+	if opts.Decimal {
+		if valDec := toDecimal(valStr); valDec != nil {
+			val.AsDecimal = valDec
+			val.BestType = Decimal
+		}
+	}
+
+	if valInt, e := strconv.ParseInt(numString(valStr), 10, 64); e == nil {
+		toInt := int(valInt)
+		val.AsInt = &toInt
+		val.BestType = Int
+	}
+
+	if valDt := toDateFmts(valStr, opts.DateFormats); valDt != nil {
+		val.AsDate = valDt
+		val.BestType = Date
+	}
+
+	if valB := toBool(valStr); valB != nil {
+		val.AsBool = valB
+		val.BestType = Bool
+	}
+
+	if valDur := toDuration(valStr); valDur != nil {
+		val.AsDuration = valDur
+		val.BestType = Duration
+	}
+
+	if valBytes := toBytes(valStr); valBytes != nil {
+		val.AsBytes = valBytes
+		val.BestType = ByteSize
+	}
+
+	if valPct := toPercent(valStr); valPct != nil {
+		val.AsPercent = valPct
+		val.BestType = Percent
+	}
+
+	toSlices(val, opts)
+	if len(val.AsSliceS) > 1 {
+		val.BestType = SliceStr
+	}
+
+	// check slice has more than one element to call it the best choice
+	if len(val.AsSliceF) > 1 {
+		val.BestType = SliceFloat
+	}
+
+	if len(val.AsSliceI) > 1 {
+		val.BestType = SliceInt
+	}
+
+	if len(val.AsSliceD) > 1 {
+		val.BestType = SliceDate
+	}
+
+	if len(val.AsSliceB) > 1 {
+		val.BestType = SliceBool
+	}
+
+	if len(val.AsSliceDur) > 1 {
+		val.BestType = SliceDuration
+	}
+
+	if len(val.AsSlicePct) > 1 {
+		val.BestType = SlicePercent
+	}
+
+	return val
+}
+
+// unquote returns the contents of valStr if it is a double-quoted string, with escapes replaced.
+func unquote(valStr string) (string, bool) {
+	trim := strings.Trim(valStr, " \t")
+	if len(trim) < 2 || trim[0] != '"' || trim[len(trim)-1] != '"' {
+		return "", false
+	}
+
+	str, e := strconv.Unquote(trim)
+	if e != nil {
+		return "", false
+	}
+
+	return str, true
+}
+
+// toSlices populates the slice elements of val with all the slice types val.AsString supports.
+func toSlices(val *Value, opts Options) {
+	asStr := strings.Split(val.AsString, opts.listDelim())
+	// after split, trim off leading/trailing spaces and tabs
+	for ind, str := range asStr {
+		asStr[ind] = strings.Trim(str, " \t")
+	}
+
+	asInt := make([]int, 0)
+	asFloat := make([]float64, 0)
+	asDate := make([]time.Time, 0)
+	asBool := make([]bool, 0)
+	asDur := make([]time.Duration, 0)
+	asPct := make([]float64, 0)
+
+	for ind := 0; ind < len(asStr); ind++ {
+		if val, e := strconv.ParseInt(numString(asStr[ind]), 10, 64); e == nil {
+			asInt = append(asInt, int(val))
+		}
+		if val, e := strconv.ParseFloat(numString(asStr[ind]), 64); e == nil {
+			asFloat = append(asFloat, val)
+		}
+
+		if val := toDateFmts(asStr[ind], opts.DateFormats); val != nil {
+			asDate = append(asDate, *val)
+		}
+
+		if val := toBool(asStr[ind]); val != nil {
+			asBool = append(asBool, *val)
+		}
+
+		if val := toDuration(asStr[ind]); val != nil {
+			asDur = append(asDur, *val)
+		}
+
+		if val := toPercent(asStr[ind]); val != nil {
+			asPct = append(asPct, *val)
+		}
+	}
+
+	val.AsSliceS = asStr
+
+	if len(asInt) == len(asStr) {
+		val.AsSliceI = asInt
+	}
+
+	if len(asFloat) == len(asStr) {
+		val.AsSliceF = asFloat
+	}
+
+	if len(asDate) == len(asStr) {
+		val.AsSliceD = asDate
+	}
+
+	if len(asBool) == len(asStr) {
+		val.AsSliceB = asBool
+	}
+
+	if len(asDur) == len(asStr) {
+		val.AsSliceDur = asDur
+	}
+
+	if len(asPct) == len(asStr) {
+		val.AsSlicePct = asPct
+	}
+}
+
+// toDuration attempts to convert inStr to time.Duration.  A unit is required, so a plain number is not a duration.
+func toDuration(inStr string) *time.Duration {
+	trim := strings.Trim(inStr, " \t")
+	if _, e := strconv.ParseFloat(numString(trim), 64); e == nil {
+		return nil
+	}
+
+	dur, e := time.ParseDuration(trim)
+	if e != nil {
+		return nil
+	}
+
+	return &dur
+}
+
+// byteUnits are the units of byte sizes: decimal (KB = 1000 bytes) and binary (KiB = 1024 bytes).
+var byteUnits = map[string]float64{"b": 1, "kb": 1e3, "mb": 1e6, "gb": 1e9, "tb": 1e12, "pb": 1e15,
+	"kib": 1 << 10, "mib": 1 << 20, "gib": 1 << 30, "tib": 1 << 40, "pib": 1 << 50}
+
+// toBytes attempts to convert inStr to a number of bytes.  A unit, such as MB or GiB in any case, is required,
+// so a plain number is not a byte size.  Fractional sizes are rounded to the nearest byte.
+func toBytes(inStr string) *int64 {
+	trim := strings.Trim(inStr, " \t")
+	ind := strings.IndexFunc(trim, unicode.IsLetter)
+	if ind <= 0 {
+		return nil
+	}
+
+	mult, ok := byteUnits[strings.ToLower(trim[ind:])]
+	num, e := strconv.ParseFloat(strings.TrimRight(trim[:ind], " "), 64)
+	if !ok || e != nil || num < 0 || num*mult >= math.MaxInt64 {
+		return nil
+	}
+
+	b := int64(math.Round(num * mult))
+
+	return &b
+}
+
+// toPercent attempts to convert inStr, a number followed by %, to a fraction, so 75% is 0.75.
+func toPercent(inStr string) *float64 {
+	trim := strings.Trim(inStr, " \t")
+	if !strings.HasSuffix(trim, "%") {
+		return nil
+	}
+
+	pct, e := strconv.ParseFloat(numString(strings.TrimSuffix(trim, "%")), 64)
+	if e != nil {
+		return nil
+	}
+
+	pct /= 100
+
+	return &pct
+}
+
+// toDecimal attempts to convert inStr to an exact decimal.  Only what ParseFloat accepts as a finite decimal number
+// is converted, so 1/3, inf and hexadecimal numbers are not decimals.
+func toDecimal(inStr string) *big.Rat {
+	str := numString(inStr)
+	if _, e := strconv.ParseFloat(str, 64); e != nil || strings.ContainsAny(str, "/xXnN") {
+		return nil
+	}
+
+	dec, ok := new(big.Rat).SetString(str)
+	if !ok {
+		return nil
+	}
+
+	return dec
+}
+
+// toBool attempts to convert inStr to bool.  The legal values are true/false, yes/no and on/off, in any case.
+func toBool(inStr string) *bool {
+	var b bool
+	switch strings.ToLower(strings.Trim(inStr, " \t")) {
+	case "true", "yes", "on":
+		b = true
+	case "false", "no", "off":
+		b = false
+	default:
+		return nil
+	}
+
+	return &b
+}
+
+// numString prepares str to be parsed as a number by removing spaces, tabs and underscores that separate digits.
+func numString(str string) string {
+	str = CleanString(str, " \t")
+	if !strings.Contains(str, "_") {
+		return str
+	}
+
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+
+	var out []byte
+	for ind := 0; ind < len(str); ind++ {
+		// an underscore that doesn't separate digits is left in place so parsing fails
+		if str[ind] == '_' && ind > 0 && ind < len(str)-1 && isDigit(str[ind-1]) && isDigit(str[ind+1]) {
+			continue
+		}
+
+		out = append(out, str[ind])
+	}
+
+	return string(out)
+}
+
+// CleanString removes all the characters in cutSet from str
+func CleanString(str, cutSet string) string {
+	for ind := 0; ind < len(cutSet); ind++ {
+		str = strings.ReplaceAll(str, cutSet[ind:ind+1], "")
+	}
+
+	return str
+}
+
+// BuildLegals takes the string in legal.txt returning 3 slices. The first is the target key,
+// the second is a category and the third is the value.
+// The format for the string is:
+// key:required-<yes/no>
+// key:type-<string/int/float/decimal/date/bool/duration/bytes/percent or one of these, except decimal and bytes,
+// prefixed by slice, e.g. sliceint>
+// key:multiple-<yes/no>
+// key:values-<comma-separated list of legal values; each element of a slice must be legal>
+// key:requires-<another key name>
+// key:requiredif-<another key name>=<value>  key is required if the other key has the value
+// key:requiredif-<another key name>  key is required if the other key is present
+// key:min-<minimum numeric value, date, byte size or percent>
+// key:max-<maximum numeric value, date, byte size or percent>
+// key:minlen-<minimum number of slice elements>
+// key:maxlen-<maximum number of slice elements>
+// key:conflicts-<comma-separated list of keys that may not be present with key>
+// key:deprecated-<yes/message/key that replaces key, to which ApplyAliases renames key>
+// key:alias-<old key name that ApplyAliases renames to key>
+// key:default-<value ApplyDefaults uses if key is missing>
+// key:match-<regular expression the value must match>
+// key:matchfull-<yes/no>  if yes, the match expression must match each element of the value in full
+// key:pattern-<regular expression each element of the value must match in full>, as match with matchfull-yes
+// key:doc-<description of the key used by Template>
+// key:severity-<error/warn>  violations of the legals of key are errors (the default) or warnings
+//
+// Only the first two are required.
+//
+// Requirements on groups of keys have the form:
+// group:oneof-<comma-separated list of keys>  exactly one of the keys must be present
+// group:anyof-<comma-separated list of keys>  at least one of the keys must be present
+// group:exclusive-<comma-separated list of keys>  at most one of the keys may be present
+//
+// where "group" is any label for the group.
+//
+// Numeric relationships between two keys have the form:
+// label:relation-<key1><op><key2>
+//
+// where "label" is any label for the relation and op is one of <, <=, >, >=, ==, !=, e.g.
+// limits:relation-min<=max.  The relation is checked only when both keys are present.
+//
+// Groups and relations may be given a severity using their label as the key.  Keys in kv that are not in the
+// legals are reported as errors unless the legals have the line
+// *:unknown-<error/warn/ignore>
+//
+// An error is returned if a line is malformed or has an unknown field.
+func BuildLegals(legalKeys string) (keys, field, val []string, err error) {
+	for _, lgl := range strings.Split(legalKeys, "\n") {
+		if strings.Trim(lgl, " \t\r") == "" {
+			continue
+		}
+
+		kv := strings.SplitN(lgl, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, nil, nil, fmt.Errorf("bad legal definition %q: must be key:field-value", lgl)
+		}
+
+		// split on the first "-" only so values may be negative
+		fv := strings.SplitN(kv[1], "-", 2)
+		if len(fv) != 2 {
+			return nil, nil, nil, fmt.Errorf("bad legal definition %q: must be key:field-value", lgl)
+		}
+
+		if searchSlice(fv[0], legalFields) < 0 {
+			return nil, nil, nil, fmt.Errorf("unknown legal field %q for key %s", fv[0], kv[0])
+		}
+
+		// compile match expressions now so a bad one is reported here and checks use the compiled one
+		if fv[0] == "match" || fv[0] == "pattern" {
+			if _, e := compileMatch(fv[1]); e != nil {
+				return nil, nil, nil, fmt.Errorf("bad pattern %s for key %s: %v", fv[1], kv[0], e)
+			}
+		}
+
+		if fv[0] == "relation" {
+			if _, _, _, e := parseRelation(fv[1]); e != nil {
+				return nil, nil, nil, fmt.Errorf("%v for key %s", e, kv[0])
+			}
+		}
+
+		keys = append(keys, kv[0])
+		field = append(field, fv[0])
+		val = append(val, fv[1])
+	}
+
+	return keys, field, val, nil
+}
+
+// maxMatchRx is the most expressions matchRx holds.
+const maxMatchRx = 256
+
+// matchRx caches the compiled expressions of the match and pattern fields of the legals, so each is compiled
+// once.  Once it holds maxMatchRx expressions, others are compiled each time.
+var matchRx = struct {
+	sync.Mutex
+	rx map[string]*regexp.Regexp
+}{rx: make(map[string]*regexp.Regexp)}
+
+// compileMatch returns the compiled regular expression pattern, compiling it only the first time.
+func compileMatch(pattern string) (*regexp.Regexp, error) {
+	matchRx.Lock()
+	defer matchRx.Unlock()
+
+	if rx, ok := matchRx.rx[pattern]; ok {
+		return rx, nil
+	}
+
+	rx, e := regexp.Compile(pattern)
+	if e != nil {
+		return nil, e
+	}
+
+	if len(matchRx.rx) < maxMatchRx {
+		matchRx.rx[pattern] = rx
+	}
+
+	return rx, nil
+}
+
+// legalFields are the fields BuildLegals recognizes.
+var legalFields = []string{"required", "type", "multiple", "requires", "min", "max", "minlen", "maxlen", "conflicts",
+	"exclusive", "requiredif", "deprecated", "alias", "default", "match", "matchfull", "pattern", "values", "oneof",
+	"anyof", "relation", "doc", "severity", "unknown"}
+
+// getLgl returns the value from the key/field/value triple in keys/legal.txt
+func getLgl(key, field string, kl, fl, vl []string) (val string) {
+	for ind := 0; ind < len(kl); ind++ {
+		if kl[ind] == key && fl[ind] == field {
+			return vl[ind]
+		}
+	}
+
+	return ""
+}
+
+// MergeLegals returns the legals in handwritten with entries added for the keys in kv that handwritten does
+// not give a type.  The added type is inferred from the BestType of the key.  Slices are given type string.
+// Keys that are not in handwritten at all are also given a "required-no" entry.
+// Duplicate keys of a key with "multiple-yes" in handwritten are covered by that key.
+func MergeLegals(handwritten string, kv KeyVal) (string, error) {
+	kl, fl, vl, e := BuildLegals(handwritten)
+	if e != nil {
+		return "", e
+	}
+
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var added []string
+	for _, k := range keys {
+		if getLgl(k, "type", kl, fl, vl) != "" || isMultiple(k, kl, fl, vl) {
+			continue
+		}
+
+		if searchSlice(k, kl) < 0 {
+			added = append(added, k+":required-no")
+		}
+
+		vType := "string"
+		switch kv[k].Resolve().BestType {
+		case Int:
+			vType = "int"
+		case Float:
+			vType = "float"
+		case Date:
+			vType = "date"
+		case Bool:
+			vType = "bool"
+		case Duration:
+			vType = "duration"
+		case ByteSize:
+			vType = "bytes"
+		case Percent:
+			vType = "percent"
+		case Decimal:
+			vType = "decimal"
+		}
+
+		added = append(added, k+":type-"+vType)
+	}
+
+	if added == nil {
+		return handwritten, nil
+	}
+
+	return strings.TrimRight(handwritten, "\n") + "\n" + strings.Join(added, "\n"), nil
+}
+
+// isMultiple returns true if key is a numbered duplicate of a key that has "multiple-yes" in the legals.
+func isMultiple(key string, kl, fl, vl []string) bool {
+	for ind, k := range kl {
+		if fl[ind] != "multiple" || vl[ind] != "yes" || !strings.HasPrefix(key, k) || len(key) == len(k) {
+			continue
+		}
+
+		if _, e := strconv.Atoi(key[len(k):]); e == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ApplyAliases renames the keys in kv that are aliases in legalKeys to their canonical names.  Deprecated keys
+// that name their replacement are renamed to it.  A warning is returned for each key renamed.  It is an error
+// for both the old and the new key to be present.
+func ApplyAliases(kv KeyVal, legalKeys string) (warnings []string, err error) {
+	kl, fl, vl, e := BuildLegals(legalKeys)
+	if e != nil {
+		return nil, e
+	}
+
+	return applyAliases(kv, kl, fl, vl)
+}
+
+// applyAliases renames the aliases and the deprecated keys with a replacement in kv.  See ApplyAliases.
+func applyAliases(kv KeyVal, kl, fl, vl []string) (warnings []string, err error) {
+	for ind, k := range kl {
+		var oldKey, newKey, warn string
+		switch fl[ind] {
+		case "alias":
+			oldKey, newKey = CleanString(vl[ind], " \n\t"), k
+			warn = fmt.Sprintf("key %s is an alias of key %s", oldKey, newKey)
+		case "deprecated":
+			if oldKey, newKey = k, replacement(k, vl[ind], kl); newKey == "" {
+				continue
+			}
+			warn = fmt.Sprintf("key %s is deprecated: use %s", oldKey, newKey)
+		default:
+			continue
+		}
+
+		oldKeys := kv.multipleKeys(oldKey)
+		if oldKeys == nil {
+			continue
+		}
+
+		if kv.Missing(newKey) == nil {
+			if fl[ind] == "alias" {
+				return warnings, newKeyError(ErrConflict, newKey, "", oldKey,
+					fmt.Sprintf("key %s and its alias %s are both present", newKey, oldKey))
+			}
+
+			return warnings, newKeyError(ErrConflict, oldKey, "", newKey,
+				fmt.Sprintf("key %s and its replacement %s are both present", oldKey, newKey))
+		}
+
+		for _, key := range oldKeys {
+			if len(oldKeys) > 1 {
+				kv[key].root = newKey
+			}
+
+			kv[newKey+key[len(oldKey):]] = kv[key]
+			delete(kv, key)
+		}
+
+		warnings = append(warnings, warn)
+	}
+
+	return warnings, nil
+}
+
+// replacement returns the key that replaces the deprecated key k, or "" if there isn't one.  depr is the value
+// of the deprecated field of k, which names the replacement if it is another key of the legals.
+func replacement(k, depr string, kl []string) string {
+	if depr = strings.Trim(depr, " \t"); depr != k && searchSlice(depr, kl) >= 0 {
+		return depr
+	}
+
+	return ""
+}
+
+// ApplyDefaults adds the keys in legalKeys that have a default to kv if they are missing and not required.
+// The Value is created by Populate from the default.
+func ApplyDefaults(kv KeyVal, legalKeys string) error {
+	kl, fl, vl, e := BuildLegals(legalKeys)
+	if e != nil {
+		return e
+	}
+
+	applyDefaults(kv, kl, fl, vl, Options{})
+
+	return nil
+}
+
+// applyDefaults adds the missing keys with defaults in the legals kl, fl, vl to kv, populated using opts.
+func applyDefaults(kv KeyVal, kl, fl, vl []string, opts Options) {
+	for ind, k := range kl {
+		if fl[ind] != "default" || kv.Missing(k) == nil || getLgl(k, "required", kl, fl, vl) == "yes" {
+			continue
+		}
+
+		kv[k] = populate(vl[ind], opts)
+	}
+}
+
+// CheckLegals builds the legal keys, types and "required" then checks kv against this.
+// CheckLegals returns the first error it finds in this order:
+//   - malformed legalKeys
+//   - missing required key
+//   - bad value (type, legal values, numeric range, slice length)
+//   - unknown keys
+//
+// If you don't care about extra keys, you can just ignore the last error.
+//
+// Missing keys, bad values, unknown keys and keys that can't be present together are reported as a *KeyError.
+// Use errors.Is with ErrMissingKey, ErrBadType, ErrIllegalValue, ErrUnknownKey and ErrConflict to tell them apart.
+// A oneof or anyof group with no key present is ErrMissingKey.
+func CheckLegals(kv KeyVal, legalKeys string) error {
+	return CheckLegalsWithHooks(kv, legalKeys, nil)
+}
+
+// CheckLegalsWarn runs CheckLegals and also returns warnings for the keys in kv that are deprecated and the
+// violations that have severity warn.  The warnings are returned whether or not there is an error.
+func CheckLegalsWarn(kv KeyVal, legalKeys string) (warnings []string, err error) {
+	kl, fl, vl, e := BuildLegals(legalKeys)
+	if e != nil {
+		return nil, e
+	}
+
+	warnings = deprecations(kv, kl, fl, vl)
+	errs, warns := checkLegals(kv, kl, fl, vl, nil, false)
+	if errs != nil {
+		err = errs[0]
+	}
+
+	return append(warnings, warns...), err
+}
+
+// ValidationReport holds every problem found by CheckLegalsAll.
+type ValidationReport struct {
+	Errors   []error  // violations of the legals, in the order CheckLegals checks them
+	Warnings []string // deprecated keys present in kv and violations with severity warn
+}
+
+// OK returns true if the report has no errors.  Warnings do not count.
+func (r *ValidationReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// CheckLegalsAll checks kv against legalKeys like CheckLegals but, rather than stopping at the first violation,
+// collects all of them.  If legalKeys is malformed, that is the only error reported.
+func CheckLegalsAll(kv KeyVal, legalKeys string) *ValidationReport {
+	kl, fl, vl, e := BuildLegals(legalKeys)
+	if e != nil {
+		return &ValidationReport{Errors: []error{e}}
+	}
+
+	errs, warnings := checkLegals(kv, kl, fl, vl, nil, true)
+
+	return &ValidationReport{Errors: errs, Warnings: append(deprecations(kv, kl, fl, vl), warnings...)}
+}
+
+// deprecations returns a warning for each key in kv that is deprecated.
+func deprecations(kv KeyVal, kl, fl, vl []string) (warnings []string) {
+	for ind, k := range kl {
+		if fl[ind] != "deprecated" || kv.Missing(k) != nil {
+			continue
+		}
+
+		warn := fmt.Sprintf("key %s is deprecated", k)
+		switch newKey := replacement(k, vl[ind], kl); {
+		case newKey != "":
+			warn = fmt.Sprintf("%s: use %s", warn, newKey)
+		case vl[ind] != "yes":
+			warn = fmt.Sprintf("%s: %s", warn, vl[ind])
+		}
+
+		warnings = append(warnings, warn)
+	}
+
+	return warnings
+}
+
+// CheckLegalsOpts runs CheckLegals followed by the Validators in opts.  See CheckLegalsWithHooks.
+func CheckLegalsOpts(kv KeyVal, legalKeys string, opts Options) error {
+	return CheckLegalsWithHooks(kv, legalKeys, opts.Validators)
+}
+
+// CheckLegalsWithHooks runs CheckLegals and then calls the hook for each key in hooks that is present in kv.
+// If the key has duplicates, the hook is called for each of them.  The first error returned by a hook is returned.
+func CheckLegalsWithHooks(kv KeyVal, legalKeys string, hooks map[string]func(*Value) error) error {
+	kl, fl, vl, e := BuildLegals(legalKeys)
+	if e != nil {
+		return e
+	}
+
+	if errs, _ := checkLegals(kv, kl, fl, vl, hooks, false); errs != nil {
+		return errs[0]
+	}
+
+	return nil
+}
+
+// checkLegals checks kv against the legals built by BuildLegals and runs the hooks.  If all is false, it stops at
+// the first violation.  Violations of keys with severity warn, and unknown keys if so set, are warnings.
+func checkLegals(kv KeyVal, kl, fl, vl []string, hooks map[string]func(*Value) error, all bool) (errs []error,
+	warnings []string) {
+	// add records a violation of the legals of key and reports whether checking should stop.  If key has
+	// severity warn, the violation is a warning.
+	add := func(key string, e error) bool {
+		if getLgl(key, "severity", kl, fl, vl) == "warn" {
+			warnings = append(warnings, e.Error())
+			return false
+		}
+
+		errs = append(errs, e)
+		return !all
+	}
+
+	// keys that admit duplicates need a * appended to their names
+	var unique []string
+	for ind, k := range kl {
+		// a deprecated key is legal even if it doesn't have a required field
+		if fl[ind] == "required" || (fl[ind] == "deprecated" && getLgl(k, "required", kl, fl, vl) == "") {
+			keyn := k
+			if getLgl(k, "multiple", kl, fl, vl) == "yes" {
+				keyn += "*"
+			}
+			unique = append(unique, keyn)
+		}
+	}
+
+	// required keys
+	for ind, k := range kl {
+		if fl[ind] == "required" && vl[ind] == "yes" && kv.Missing(k) != nil {
+			if add(k, newKeyError(ErrMissingKey, k, "", "", fmt.Sprintf("missing required key %s", k))) {
+				return errs, warnings
+			}
+		}
+	}
 
-	for {
-		nextLine = line
+	// keys required by the value of another key
+	for ind, k := range kl {
+		if fl[ind] != "requiredif" || kv.Missing(k) == nil {
+			continue
+		}
 
-		for done == 0 {
-			if line, e = rdr.ReadString(LineEOL[0]); e == io.EOF {
-				done = 1 // hit EOF, so process nextLine and line
-				if line == "" {
-					done = 2 // EOF and the line was blank--so process nextline and quit
-					break
-				}
-			}
+		other, want, hasWant := strings.Cut(CleanString(vl[ind], " \n\t"), "=")
+		if kv.Missing(other) != nil {
+			continue
+		}
 
-			// hit an actual error
-			if e != nil && e != io.EOF {
-				return nil, nil, e
+		if !hasWant {
+			if add(k, newKeyError(ErrMissingKey, k, "", "",
+				fmt.Sprintf("missing key %s, required when %s is present", k, other))) {
+				return errs, warnings
 			}
 
-			line = strings.TrimLeft(strings.TrimRight(line, LineEOL), " ")
+			continue
+		}
 
-			// lines must be at least 2 characters
-			if line == "" || len(line) < 2 {
+		// if other is duplicated, any occurrence with the value makes key required
+		for _, v := range kv.GetMultiple(other) {
+			if !isLegalValue(v.AsString, []string{want}) {
 				continue
 			}
 
-			// entire line is a comment
-			if line[0:2] == "//" {
-				continue
+			if add(k, newKeyError(ErrMissingKey, k, "", "",
+				fmt.Sprintf("missing key %s, required when %s is %s", k, other, want))) {
+				return errs, warnings
 			}
 
-			// line has comment
-			if ind := strings.Index(line, "//"); ind >= 0 {
-				line = line[0:ind]
-				line = strings.TrimRight(line, " ")
-			}
+			break
+		}
+	}
 
-			// are these separate entries?
-			if strings.Contains(nextLine, KVDelim) && strings.Contains(line, KVDelim) {
-				break
-			}
+	// groups of keys
+	for ind, field := range fl {
+		if field != "oneof" && field != "anyof" && field != "exclusive" {
+			continue
+		}
 
-			// append and keep reading
-			nextLine = fmt.Sprintf("%s %s", nextLine, line)
-			if done == 1 {
-				done = 2
+		if e := checkGroup(kv, kl[ind], field, vl[ind]); e != nil && add(kl[ind], e) {
+			return errs, warnings
+		}
+	}
+
+	// keys that can't coexist
+	for ind, k := range kl {
+		if fl[ind] != "conflicts" || kv.Missing(k) != nil {
+			continue
+		}
+
+		for _, other := range strings.Split(CleanString(vl[ind], " \n\t"), ",") {
+			if other != "" && kv.Missing(other) == nil {
+				if add(k, newKeyError(ErrConflict, k, "", other, fmt.Sprintf("key %s conflicts with key %s", k, other))) {
+					return errs, warnings
+				}
 			}
 		}
+	}
 
-		// split into key and val
-		kvSlice := strings.SplitN(nextLine, KVDelim, 2)
-		if len(kvSlice) != 2 {
-			return nil, nil, fmt.Errorf("bad key val: %s in file %s", nextLine, specFile)
+	// check the values of each key, including each member of duplicate keys, and required secondary keys.
+	// Hooks are not run on values that fail.
+	seen := make(map[string]bool)
+	bad := make(map[*Value]bool)
+	for _, k := range kl {
+		if seen[k] {
+			continue
 		}
+		seen[k] = true
 
-		key := strings.ReplaceAll(kvSlice[0], " ", "")
-		val := strings.TrimLeft(kvSlice[1], " ")
-		if key == "include" {
-			ks, vs, e := ReadKV2Slc(val)
-			if e != nil {
-				return nil, nil, e
+		vals := kv.GetMultiple(k)
+		for ind, v := range vals {
+			label := k
+			if len(vals) > 1 {
+				label = fmt.Sprintf("%s (occurrence %d)", k, ind+1)
 			}
 
-			for ind := 0; ind < len(ks); ind++ {
-				keys = append(keys, ks[ind])
-				vals = append(vals, vs[ind])
+			if e := checkValue(k, label, v, kl, fl, vl); e != nil {
+				bad[v] = true
+				if add(k, e) {
+					return errs, warnings
+				}
 			}
+		}
 
-			continue
+		// see if another key is required
+		if requires := getLgl(k, "requires", kl, fl, vl); requires != "" && vals != nil {
+			if kv.Missing(requires) != nil {
+				if add(k, newKeyError(ErrMissingKey, requires, "", "", fmt.Sprintf("missing required key %s", requires))) {
+					return errs, warnings
+				}
+			}
 		}
+	}
 
-		keys = append(keys, key)
-		vals = append(vals, val)
+	// relationships between keys
+	for ind, field := range fl {
+		if field != "relation" {
+			continue
+		}
 
-		if done == 2 {
-			return keys, vals, nil
+		if e := checkRelation(kv, vl[ind]); e != nil && add(kl[ind], e) {
+			return errs, warnings
 		}
+	}
 
-		// The next iteration will be the last.  We won't do any more reading if done=1.
-		if done == 1 {
-			done++
+	// look for unrecognized keys
+	if unks := kv.Unknown(strings.Join(unique, ",")); unks != nil {
+		e := newKeyError(ErrUnknownKey, strings.Join(unks, ","), "", "", fmt.Sprintf("unknown key(s): %v", unks))
+		switch getLgl("*", "unknown", kl, fl, vl) {
+		case "warn":
+			warnings = append(warnings, e.Error())
+		case "ignore":
+		default:
+			if add("", e) {
+				return errs, warnings
+			}
 		}
 	}
-}
 
-// ProcessKVs process keys and vals as two slices of string.  It returns a KeyVal.
-func ProcessKVs(keys, vals []string) (kv KeyVal, err error) {
-	if keys == nil || vals == nil {
-		return nil, fmt.Errorf("nil slice passes to ProcessKVs")
+	// run the hooks in key order so the error returned is deterministic
+	hookKeys := make([]string, 0, len(hooks))
+	for k := range hooks {
+		hookKeys = append(hookKeys, k)
 	}
+	sort.Strings(hookKeys)
 
-	if len(keys) != len(vals) {
-		return nil, fmt.Errorf("slices not same length in ProcessKVs")
+	for _, k := range hookKeys {
+		for _, v := range kv.GetMultiple(k) {
+			if bad[v] {
+				continue
+			}
+
+			if e := hooks[k](v); e != nil && add(k, e) {
+				return errs, warnings
+			}
+		}
 	}
 
-	kv = make(KeyVal)
-	for indx := 0; indx < len(keys); indx++ {
-		// spaces mean nothing
-		base := keys[indx]
+	return errs, warnings
+}
 
-		// now we test to see if this key is a duplicate
-		key, keyTest := base, base
+// checkGroup checks a oneof, anyof or exclusive requirement of the legals for the group labeled key.  members is
+// the comma-separated list of keys.  The error is a *KeyError with Expected the members and Actual the count
+// present.
+func checkGroup(kv KeyVal, key, field, members string) error {
+	group := strings.Split(CleanString(members, " \n\t"), ",")
+	count := len(group) - len(kv.Missing(members))
 
-		// if key isn't there but if it's a duplicate, the first entry might already have had "1" appended.
-		if _, ok := kv[base]; !ok {
-			keyTest = base + "1"
-		}
+	kind := ErrConflict
+	if count == 0 {
+		kind = ErrMissingKey
+	}
 
-		// look for duplicates and stop when we run out
-		ind := 1
-		for _, ok := kv[keyTest]; ok; _, ok = kv[keyTest] {
-			ind++
-			keyTest = fmt.Sprintf("%s%d", base, ind)
-			key = keyTest
-		}
+	expected, actual := strings.Join(group, ","), strconv.Itoa(count)
+	if field == "oneof" && count != 1 {
+		return newKeyError(kind, key, expected, actual, fmt.Sprintf("exactly one of %v required, got %d", group, count))
+	}
 
-		// In this case, we have a duplicate but this is the first dup.  In that case, append a "1" to the first
-		// instance and drop the original.
-		if ind == 2 {
-			kv[base+"1"] = kv[base]
-			delete(kv, base)
-		}
+	if field == "anyof" && count == 0 {
+		return newKeyError(kind, key, expected, actual, fmt.Sprintf("at least one of %v required", group))
+	}
 
-		kv[key] = Populate(vals[indx])
+	if field == "exclusive" && count > 1 {
+		return newKeyError(kind, key, expected, actual, fmt.Sprintf("at most one of %v allowed, got %d", group, count))
 	}
 
-	return kv, nil
+	return nil
 }
 
-// ReadKV reads a key/val set from specFile and returns KeyVal
-func ReadKV(specFile string) (keyval KeyVal, err error) {
-	keys, vals, e := ReadKV2Slc(specFile)
+// checkRelation checks a numeric relationship between keys given by a relation field of the legals.
+func checkRelation(kv KeyVal, rel string) error {
+	rel = CleanString(rel, " \n\t")
+	key0, op, key1, e := parseRelation(rel)
 	if e != nil {
-		return keyval, e
+		return e
 	}
 
-	return ProcessKVs(keys, vals)
-}
+	keys := []string{key0, key1}
+	left, right := kv.Get(keys[0]), kv.Get(keys[1])
+	if left == nil || right == nil {
+		return nil
+	}
 
-// toDate attempts to convert inStr to time.Time
-func toDate(inStr string) *time.Time {
-	fmts := []string{"2006-01-02", "2006-1-2", "2006/01/02", "2006/1/2", "20060102", "01022006",
-		"01/02/2006", "1/2/2006", "01-02-2006", "1-2-2006", "200601", "Jan 2 2006", "January 2 2006",
-		"Jan 2, 2006", "January 2, 2006", time.RFC3339}
-	trim := strings.TrimRight(strings.TrimLeft(inStr, " "), " ")
-	for _, fm := range fmts {
-		dt, err := time.Parse(fm, trim)
-		if err == nil {
-			return &dt
+	for side, v := range []*Value{left, right} {
+		if v.AsFloat == nil {
+			return newKeyError(ErrBadType, keys[side], "numeric", v.AsString,
+				fmt.Sprintf("value %s for key %s must be numeric for relation %s", v.AsString, keys[side], rel))
 		}
 	}
 
+	l, r := *left.AsFloat, *right.AsFloat
+
+	var ok bool
+	switch op {
+	case "<=":
+		ok = l <= r
+	case ">=":
+		ok = l >= r
+	case "==":
+		ok = l == r
+	case "!=":
+		ok = l != r
+	case "<":
+		ok = l < r
+	case ">":
+		ok = l > r
+	}
+
+	if !ok {
+		return newKeyError(ErrIllegalValue, keys[0], rel, strings.Trim(left.AsString, " "),
+			fmt.Sprintf("relation %s failed: %s is %s, %s is %s", rel,
+				keys[0], strings.Trim(left.AsString, " "), keys[1], strings.Trim(right.AsString, " ")))
+	}
+
 	return nil
 }
 
-// Populate populates all the legal values that valStr can accommodate.  The AsString field is always populated.
-// The BestType is set using the order of precedence described under the type DataType.
-func Populate(valStr string) *Value {
-	val := &Value{AsString: valStr, BestType: String}
+// parseRelation splits the relation rel of the legals into its keys and operator.  An error is returned if it
+// doesn't have both keys and an operator.
+func parseRelation(rel string) (key1, op, key2 string, err error) {
+	rel = CleanString(rel, " \n\t")
+	for _, o := range []string{"<=", ">=", "==", "!=", "<", ">"} {
+		if strings.Contains(rel, o) {
+			op = o
+			break
+		}
+	}
 
-	if valFloat, e := strconv.ParseFloat(strings.ReplaceAll(valStr, " ", ""), 64); e == nil {
-		toFloat := valFloat
-		val.AsFloat = &toFloat
-		val.BestType = Float
+	if op == "" {
+		return "", "", "", fmt.Errorf("bad relation %s", rel)
 	}
 
-	if valInt, e := strconv.ParseInt(strings.ReplaceAll(valStr, " ", ""), 10, 64); e == nil {
-		toInt := int(valInt)
-		val.AsInt = &toInt
-		val.BestType = Int
+	keys := strings.SplitN(rel, op, 2)
+	if keys[0] == "" || keys[1] == "" {
+		return "", "", "", fmt.Errorf("bad relation %s", rel)
 	}
 
-	if valDt := toDate(valStr); valDt != nil {
-		val.AsDate = valDt
-		val.BestType = Date
+	return keys[0], op, keys[1], nil
+}
+
+// checkValue checks the value v of key against the type, values, min, max, minlen and maxlen fields of the legals.
+// label is the name of the key used in errors.
+func checkValue(key, label string, v *Value, kl, fl, vl []string) error {
+	v.Resolve()
+	actual := strings.Trim(v.AsString, " ")
+	switch vType := getLgl(key, "type", kl, fl, vl); vType {
+	case "int":
+		if v.AsInt == nil {
+			return newKeyError(ErrBadType, key, vType, actual, fmt.Sprintf("value to key %s must be integer", label))
+		}
+	case "float":
+		if v.AsFloat == nil {
+			return newKeyError(ErrBadType, key, vType, actual, fmt.Sprintf("value to key %s must be float", label))
+		}
+	case "date":
+		if v.AsDate == nil {
+			return newKeyError(ErrBadType, key, vType, actual, fmt.Sprintf("value to key %s must be date", label))
+		}
+	case "bool":
+		if v.AsBool == nil {
+			return newKeyError(ErrBadType, key, vType, actual, fmt.Sprintf("value to key %s must be bool", label))
+		}
+	case "duration":
+		if v.AsDuration == nil {
+			return newKeyError(ErrBadType, key, vType, actual, fmt.Sprintf("value to key %s must be duration", label))
+		}
+	case "bytes":
+		if v.AsBytes == nil {
+			return newKeyError(ErrBadType, key, vType, actual, fmt.Sprintf("value to key %s must be a byte size", label))
+		}
+	case "decimal":
+		// the Value need not be read with Decimal set for the check
+		if toDecimal(v.AsString) == nil {
+			return newKeyError(ErrBadType, key, vType, actual, fmt.Sprintf("value to key %s must be decimal", label))
+		}
+	case "percent":
+		if v.AsPercent == nil {
+			return newKeyError(ErrBadType, key, vType, actual, fmt.Sprintf("value to key %s must be percent", label))
+		}
+	case "slicestr", "sliceint", "slicefloat", "slicedate", "slicebool", "sliceduration", "slicepercent":
+		elemType := strings.TrimPrefix(vType, "slice")
+		ok := map[string]bool{"str": v.AsSliceS != nil, "int": v.AsSliceI != nil, "float": v.AsSliceF != nil,
+			"date": v.AsSliceD != nil, "bool": v.AsSliceB != nil, "duration": v.AsSliceDur != nil,
+			"percent": v.AsSlicePct != nil}
+		if !ok[elemType] {
+			return newKeyError(ErrBadType, key, vType, actual,
+				fmt.Sprintf("value to key %s must be a slice of %s", label, elemType))
+		}
 	}
 
-	if slcS, slcI, slcF, slcD := toSlices(valStr); slcS != nil {
-		val.AsSliceS, val.AsSliceI, val.AsSliceF, val.AsSliceD = slcS, slcI, slcF, slcD
-		if len(slcS) > 1 {
-			val.BestType = SliceStr
+	// see if there is a list of legal values.  Each element of a slice must be legal.
+	if vals := getLgl(key, "values", kl, fl, vl); vals != "" {
+		elems := v.AsSliceS
+		if elems == nil {
+			elems = []string{v.AsString}
 		}
 
-		// check slice has more than one element to call it the best choice
-		if len(slcF) > 1 {
-			val.BestType = SliceFloat
+		for _, elem := range elems {
+			if !isLegalValue(elem, strings.Split(vals, ",")) {
+				return newKeyError(ErrIllegalValue, key, vals, elem, fmt.Sprintf("illegal value %s for key %s", elem, label))
+			}
 		}
+	}
 
-		if len(slcI) > 1 {
-			val.BestType = SliceInt
+	// see if the value, or with matchfull each element in full, must match a regular expression
+	if pattern := getLgl(key, "match", kl, fl, vl); pattern != "" {
+		if e := checkPattern(key, label, v, pattern, getLgl(key, "matchfull", kl, fl, vl) == "yes"); e != nil {
+			return e
 		}
+	}
 
-		if len(slcD) > 1 {
-			val.BestType = SliceDate
+	if pattern := getLgl(key, "pattern", kl, fl, vl); pattern != "" {
+		if e := checkPattern(key, label, v, pattern, true); e != nil {
+			return e
 		}
 	}
 
-	return val
+	// check numeric range and slice length
+	return checkRange(key, label, v, kl, fl, vl)
 }
 
-// toSlices converts input into all the slice types it supports.
-func toSlices(input string) (asStr []string, asInt []int, asFloat []float64, asDate []time.Time) {
-	asStr = strings.Split(input, ListDelim)
-	// after split, trim off leading/trailing spaces
-	for ind, str := range asStr {
-		asStr[ind] = strings.TrimRight(strings.TrimLeft(str, " "), " ")
+// checkPattern checks that v matches the regular expression pattern or, if full, that each element of v
+// matches it in full.  The error reports the element that fails.
+func checkPattern(key, label string, v *Value, pattern string, full bool) error {
+	expr, elems := pattern, []string{strings.Trim(v.AsString, " ")}
+	if full {
+		expr = "^(?:" + pattern + ")$"
+		if v.AsSliceS != nil {
+			elems = v.AsSliceS
+		}
 	}
 
-	asInt = make([]int, 0)
-	asFloat = make([]float64, 0)
-	asDate = make([]time.Time, 0)
+	rx, e := compileMatch(expr)
+	if e != nil {
+		return fmt.Errorf("bad pattern %s for key %s: %v", pattern, key, e)
+	}
 
-	for ind := 0; ind < len(asStr); ind++ {
-		if val, e := strconv.ParseInt(strings.ReplaceAll(asStr[ind], " ", ""), 10, 64); e == nil {
-			asInt = append(asInt, int(val))
-		}
-		if val, e := strconv.ParseFloat(strings.ReplaceAll(asStr[ind], " ", ""), 64); e == nil {
-			asFloat = append(asFloat, val)
+	for ind, elem := range elems {
+		if rx.MatchString(elem) {
+			continue
 		}
 
-		if val := toDate(asStr[ind]); val != nil {
-			asDate = append(asDate, *val)
+		if len(elems) == 1 {
+			return newKeyError(ErrIllegalValue, key, pattern, elem,
+				fmt.Sprintf("value %s for key %s does not match pattern %s", elem, label, pattern))
 		}
-	}
 
-	if len(asInt) != len(asStr) {
-		asInt = nil
+		return newKeyError(ErrIllegalValue, key, pattern, elem,
+			fmt.Sprintf("element %d (%s) of value for key %s does not match pattern %s", ind+1, elem, label, pattern))
 	}
 
-	if len(asFloat) != len(asStr) {
-		asFloat = nil
-	}
+	return nil
+}
 
-	if len(asDate) != len(asStr) {
-		asDate = nil
-	}
+// checkRange checks the value v of key against the min, max, minlen and maxlen fields of the legals.  min and max
+// are dates if they are not numbers or if the key has type date.  Byte sizes are compared in bytes and percents
+// as fractions, so a plain number limit for a percent is a fraction.
+// label is the name of the key used in errors.
+func checkRange(key, label string, v *Value, kl, fl, vl []string) error {
+	val := strings.Trim(v.AsString, " ")
 
-	return asStr, asInt, asFloat, asDate
-}
+	for _, bound := range []string{"min", "max"} {
+		lim := getLgl(key, bound, kl, fl, vl)
+		if lim == "" {
+			continue
+		}
 
-// CleanString removes all the characters in cutSet from str
-func CleanString(str, cutSet string) string {
-	for ind := 0; ind < len(cutSet); ind++ {
-		str = strings.ReplaceAll(str, cutSet[ind:ind+1], "")
-	}
+		// dates are compared chronologically
+		limit, e := strconv.ParseFloat(lim, 64)
+		if limDt := toDate(lim); limDt != nil && (e != nil || getLgl(key, "type", kl, fl, vl) == "date") {
+			if v.AsDate == nil {
+				return newKeyError(ErrBadType, key, "date", val, fmt.Sprintf("value %s for key %s must be a date", val, label))
+			}
 
-	return str
-}
+			if bound == "min" && v.AsDate.Before(*limDt) {
+				return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+					fmt.Sprintf("value %s for key %s is before min %s", val, label, lim))
+			}
+
+			if bound == "max" && v.AsDate.After(*limDt) {
+				return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+					fmt.Sprintf("value %s for key %s is after max %s", val, label, lim))
+			}
 
-// BuildLegals takes the string in legal.txt returning 3 slices. The first is the target key,
-// the second is a category and the third is the value.
-// The format for the string is:
-// key:required-<yes/no>
-// key:type-<string/int/float>
-// key:multiples-<yes/no>
-// key:requires-<another key name>
-//
-// Only the first two are required.
-func BuildLegals(legalKeys string) (keys, field, val []string) {
-	for _, lgl := range strings.Split(legalKeys, "\n") {
-		if lgl == "" {
 			continue
 		}
 
-		kv := strings.Split(lgl, ":")
-		keys = append(keys, kv[0])
-		fv := strings.Split(kv[1], "-")
-		field = append(field, fv[0])
-		val = append(val, fv[1])
-	}
+		// byte sizes are compared in bytes, the limit may be a byte size or a plain number
+		if limB := toBytes(lim); limB != nil || getLgl(key, "type", kl, fl, vl) == "bytes" || v.AsBytes != nil {
+			if limB == nil && e == nil {
+				b := int64(math.Round(limit))
+				limB = &b
+			}
 
-	return keys, field, val
-}
+			if limB == nil {
+				return fmt.Errorf("bad %s %s for key %s", bound, lim, key)
+			}
 
-// getLgl returns the value from the key/field/value triple in keys/legal.txt
-func getLgl(key, field string, kl, fl, vl []string) (val string) {
-	for ind := 0; ind < len(kl); ind++ {
-		if kl[ind] == key && fl[ind] == field {
-			return vl[ind]
+			if v.AsBytes == nil {
+				return newKeyError(ErrBadType, key, "bytes", val, fmt.Sprintf("value %s for key %s must be a byte size", val,
+					label))
+			}
+
+			if bound == "min" && *v.AsBytes < *limB {
+				return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+					fmt.Sprintf("value %s for key %s is below min %s", val, label, lim))
+			}
+
+			if bound == "max" && *v.AsBytes > *limB {
+				return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+					fmt.Sprintf("value %s for key %s exceeds max %s", val, label, lim))
+			}
+
+			continue
 		}
-	}
 
-	return ""
-}
+		// percents are compared as fractions, the limit may be a percent or a fraction
+		if limPct := toPercent(lim); limPct != nil || getLgl(key, "type", kl, fl, vl) == "percent" ||
+			v.AsPercent != nil {
+			if limPct == nil && e == nil {
+				limPct = &limit
+			}
 
-// CheckLegals builds the legal keys, types and "required" then checks kv against this.
-// CheckLegals returns the first error it finds in this order:
-//   - missing required key
-//   - bad value
-//   - unknown keys
-//
-// If you don't care about extra keys, you can just ignore the last error.
-func CheckLegals(kv KeyVal, legalKeys string) error {
-	kl, fl, vl := BuildLegals(legalKeys)
+			if limPct == nil {
+				return fmt.Errorf("bad %s %s for key %s", bound, lim, key)
+			}
 
-	// keys that admit duplicates need a * appended to their names
-	var unique []string
-	for ind, k := range kl {
-		if fl[ind] == "required" {
-			keyn := k
-			if getLgl(k, "multiple", kl, fl, vl) == "yes" {
-				keyn += "*"
+			if v.AsPercent == nil {
+				return newKeyError(ErrBadType, key, "percent", val, fmt.Sprintf("value %s for key %s must be percent", val,
+					label))
 			}
-			unique = append(unique, keyn)
+
+			if bound == "min" && *v.AsPercent < *limPct {
+				return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+					fmt.Sprintf("value %s for key %s is below min %s", val, label, lim))
+			}
+
+			if bound == "max" && *v.AsPercent > *limPct {
+				return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+					fmt.Sprintf("value %s for key %s exceeds max %s", val, label, lim))
+			}
+
+			continue
 		}
-	}
 
-	// required keys
-	for ind, k := range kl {
-		if fl[ind] == "required" && vl[ind] == "yes" && kv.Missing(k) != nil {
-			return fmt.Errorf("missing required key %s", k)
+		if e != nil {
+			return fmt.Errorf("bad %s %s for key %s", bound, lim, key)
 		}
-	}
 
-	// cycle through and check types and required secondary keys
-	for k, v := range kv {
-		if vType := getLgl(k, "type", kl, fl, vl); vType == "int" {
-			if v.AsInt == nil {
-				return fmt.Errorf("value to key %s must be integer", k)
+		// decimals are compared exactly
+		if limDec := toDecimal(lim); limDec != nil && v.AsDecimal != nil {
+			if bound == "min" && v.AsDecimal.Cmp(limDec) < 0 {
+				return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+					fmt.Sprintf("value %s for key %s is below min %s", val, label, lim))
 			}
-		}
 
-		// see if there is a list of legal values
-		if vals := getLgl(k, "values", kl, fl, vl); vals != "" {
-			if searchSlice(v.AsString, strings.Split(vals, ",")) < 0 {
-				return fmt.Errorf("illegal value %s for key %s", v.AsString, k)
+			if bound == "max" && v.AsDecimal.Cmp(limDec) > 0 {
+				return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+					fmt.Sprintf("value %s for key %s exceeds max %s", val, label, lim))
 			}
+
+			continue
 		}
 
-		// see if another key is required
-		if requires := getLgl(k, "requires", kl, fl, vl); requires != "" {
-			if kv.Missing(requires) != nil {
-				return fmt.Errorf("missing required key %s", requires)
-			}
+		if v.AsFloat == nil {
+			return newKeyError(ErrBadType, key, "numeric", val, fmt.Sprintf("value %s for key %s must be numeric", val, label))
+		}
+
+		if bound == "min" && *v.AsFloat < limit {
+			return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+				fmt.Sprintf("value %s for key %s is below min %s", val, label, lim))
+		}
+
+		if bound == "max" && *v.AsFloat > limit {
+			return newKeyError(ErrIllegalValue, key, bound+" "+lim, val,
+				fmt.Sprintf("value %s for key %s exceeds max %s", val, label, lim))
 		}
 	}
 
-	// look for unrecognized keys
-	if unks := kv.Unknown(strings.Join(unique, ",")); unks != nil {
-		return fmt.Errorf("unknown key(s): %v", unks)
+	for _, bound := range []string{"minlen", "maxlen"} {
+		lim := getLgl(key, bound, kl, fl, vl)
+		if lim == "" {
+			continue
+		}
+
+		limit, e := strconv.Atoi(lim)
+		if e != nil {
+			return fmt.Errorf("bad %s %s for key %s", bound, lim, key)
+		}
+
+		if bound == "minlen" && len(v.AsSliceS) < limit {
+			return newKeyError(ErrIllegalValue, key, bound+" "+lim, strconv.Itoa(len(v.AsSliceS)),
+				fmt.Sprintf("key %s has %d elements, fewer than minlen %s", label, len(v.AsSliceS), lim))
+		}
+
+		if bound == "maxlen" && len(v.AsSliceS) > limit {
+			return newKeyError(ErrIllegalValue, key, bound+" "+lim, strconv.Itoa(len(v.AsSliceS)),
+				fmt.Sprintf("key %s has %d elements, more than maxlen %s", label, len(v.AsSliceS), lim))
+		}
 	}
 
 	return nil
 }
 
+// isLegalValue returns true if val is one of legals.  Leading and trailing spaces are ignored.
+// If val and a legal value are both numbers, they are compared numerically.
+func isLegalValue(val string, legals []string) bool {
+	val = strings.Trim(val, " \t")
+	valF, eVal := strconv.ParseFloat(numString(val), 64)
+
+	for _, lgl := range legals {
+		lgl = strings.Trim(lgl, " \t")
+		if lgl == val {
+			return true
+		}
+
+		if lglF, e := strconv.ParseFloat(numString(lgl), 64); e == nil && eVal == nil && lglF == valF {
+			return true
+		}
+	}
+
+	return false
+}
+
 // searchSlice checks the joinField is present in the Pipeline
 func searchSlice(needle string, haystack []string) (loc int) {
 	for ind, hay := range haystack {
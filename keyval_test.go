@@ -1,9 +1,19 @@
 package keyval
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -185,6 +195,7 @@ func TestCleanString(t *testing.T) {
 
 func TestKeyVal_GetBest(t *testing.T) {
 	ListDelim = "|"
+	defer func() { ListDelim = "," }()
 	inKeys := []string{"key0", "key1", "key2", "key3", "key4", "key5", "key6", "key7"}
 	inVals := []string{
 		"42",
@@ -368,3 +379,1691 @@ key4:type-string`
 	// missing required key key4
 	// unknown key(s): [key5]
 }
+
+func TestCheckLegals_Range(t *testing.T) {
+	const legalDefs = `
+port:required-yes
+port:type-int
+port:min-1
+port:max-100
+hosts:required-no
+hosts:minlen-2
+hosts:maxlen-3
+offset:required-no
+offset:min--5.5`
+
+	keys := []string{"port", "hosts", "offset"}
+	vals := []string{"80", "a,b", "-2"}
+
+	kv, err := ProcessKVs(keys, vals)
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["port"] = Populate("150")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value 150 for key port exceeds max 100")
+
+	kv["port"] = Populate("0")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value 0 for key port is below min 1")
+
+	kv["port"] = Populate("80")
+	kv["offset"] = Populate("-6")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value -6 for key offset is below min -5.5")
+
+	kv["offset"] = Populate("-2")
+	kv["hosts"] = Populate("a")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "key hosts has 1 elements, fewer than minlen 2")
+
+	kv["hosts"] = Populate("a,b,c,d")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "key hosts has 4 elements, more than maxlen 3")
+}
+
+func TestCheckLegalsWithHooks(t *testing.T) {
+	const legalDefs = `
+port:required-yes
+port:type-int
+port:min-1
+port:max-65535`
+
+	hooks := map[string]func(*Value) error{
+		"port": func(v *Value) error {
+			if *v.AsInt < 1024 {
+				return fmt.Errorf("port %d is reserved", *v.AsInt)
+			}
+			return nil
+		},
+	}
+
+	kv, err := ProcessKVs([]string{"port"}, []string{"8080"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegalsWithHooks(kv, legalDefs, hooks))
+
+	// passes the built-in checks but not the hook
+	kv["port"] = Populate("80")
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+	assert.EqualError(t, CheckLegalsWithHooks(kv, legalDefs, hooks), "port 80 is reserved")
+}
+
+func TestReadKVOpts_IncludeResolver(t *testing.T) {
+	files := map[string]string{
+		"main.txt": "a: A\ninclude: sub.txt\nc: 3\n",
+		"sub.txt":  "b: 1,2,3\n",
+	}
+
+	opts := Options{IncludeResolver: func(name string) (io.ReadCloser, error) {
+		content, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("no file %s", name)
+		}
+		return io.NopCloser(strings.NewReader(content)), nil
+	}}
+
+	kv, err := ReadKVOpts("main.txt", opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "A", kv.Get("a").AsString)
+	assert.Equal(t, []int{1, 2, 3}, kv.Get("b").AsSliceI)
+	assert.Equal(t, 3, *kv.Get("c").AsInt)
+
+	_, err = ReadKVOpts("missing.txt", opts)
+	assert.EqualError(t, err, "no file missing.txt")
+}
+
+// This example shows the type checks for float and date keys.
+func ExampleCheckLegals_types() {
+	const legalDefs = `
+rate:required-yes
+rate:type-float
+start:required-yes
+start:type-date`
+
+	keyval, err := ProcessKVs([]string{"rate", "start"}, []string{"0.05", "20230101"})
+	if err != nil {
+		panic(err)
+	}
+
+	if e := CheckLegals(keyval, legalDefs); e != nil {
+		panic(e)
+	}
+
+	fmt.Println("everything is good")
+
+	keyval["start"] = Populate("not a date")
+	if e := CheckLegals(keyval, legalDefs); e != nil {
+		fmt.Println(e)
+	}
+
+	keyval["start"] = Populate("20230101")
+	keyval["rate"] = Populate("high")
+	if e := CheckLegals(keyval, legalDefs); e != nil {
+		fmt.Println(e)
+	}
+	// output:
+	// everything is good
+	// value to key start must be date
+	// value to key rate must be float
+}
+
+func TestCheckLegals_Groups(t *testing.T) {
+	const legalDefs = `
+file:required-no
+inline:required-no
+host:required-no
+ip:required-no
+source:oneof-file,inline
+address:anyof-host,ip`
+
+	kv, err := ProcessKVs([]string{"file", "host"}, []string{"a.txt", "localhost"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["inline"] = Populate("a: b")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "exactly one of [file inline] required, got 2")
+
+	delete(kv, "file")
+	delete(kv, "inline")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "exactly one of [file inline] required, got 0")
+
+	kv["inline"] = Populate("a: b")
+	delete(kv, "host")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "at least one of [host ip] required")
+
+	kv["ip"] = Populate("127.0.0.1")
+	kv["host"] = Populate("localhost")
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+}
+
+func TestKeyVal_TypeHistogram(t *testing.T) {
+	keys := []string{"a", "b", "c", "d", "d", "e"}
+	vals := []string{"1", "2.5", "hello", "1,2", "3,4", "20230101"}
+
+	kv, err := ProcessKVs(keys, vals)
+	assert.Nil(t, err)
+
+	exp := map[DataType]int{Int: 1, Float: 1, String: 1, SliceInt: 2, Date: 1}
+	assert.Equal(t, exp, kv.TypeHistogram())
+}
+
+func TestCheckLegals_Conflicts(t *testing.T) {
+	const legalDefs = `
+debug:required-no
+debug:conflicts-quiet
+quiet:required-no
+quiet:multiple-yes`
+
+	kv, err := ProcessKVs([]string{"debug"}, []string{"yes"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	// quiet is a duplicate key, so it's stored as quiet1, quiet2
+	kv, err = ProcessKVs([]string{"debug", "quiet", "quiet"}, []string{"yes", "yes", "no"})
+	assert.Nil(t, err)
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "key debug conflicts with key quiet")
+
+	delete(kv, "debug")
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+}
+
+func TestPopulate_Negative(t *testing.T) {
+	val := Populate("-1.5, 2.0, -3.25")
+	assert.Equal(t, SliceFloat, val.BestType)
+	assert.Equal(t, []float64{-1.5, 2.0, -3.25}, val.AsSliceF)
+
+	val = Populate("-1,\t-2, 3")
+	assert.Equal(t, SliceInt, val.BestType)
+	assert.Equal(t, []int{-1, -2, 3}, val.AsSliceI)
+	assert.Equal(t, []string{"-1", "-2", "3"}, val.AsSliceS)
+
+	val = Populate("\t-4.5")
+	assert.Equal(t, Float, val.BestType)
+	assert.Equal(t, -4.5, *val.AsFloat)
+
+	kv, err := ReadKVOpts("offsets.txt", Options{IncludeResolver: func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("offsets: -1.5, 2.0,\n  -3.25\n")), nil
+	}})
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{-1.5, 2.0, -3.25}, kv.Get("offsets").AsSliceF)
+}
+
+func TestMergeLegals(t *testing.T) {
+	const handwritten = `
+port:required-yes
+port:type-float
+name:required-yes
+eqn:required-yes
+eqn:multiple-yes
+eqn:type-string`
+
+	keys := []string{"port", "name", "eqn", "eqn", "start", "rate", "hosts"}
+	vals := []string{"80", "app", "a=b", "b=c", "20230101", "0.5", "a,b"}
+
+	kv, err := ProcessKVs(keys, vals)
+	assert.Nil(t, err)
+
+	merged, err := MergeLegals(handwritten, kv)
+	assert.Nil(t, err)
+	exp := handwritten + `
+hosts:required-no
+hosts:type-string
+name:type-string
+rate:required-no
+rate:type-float
+start:required-no
+start:type-date`
+	assert.Equal(t, exp, merged)
+	assert.Nil(t, CheckLegals(kv, merged))
+
+	// the types of a lazily populated KeyVal are the same
+	kv, err = ProcessKVsOpts(keys, vals, Options{LazyPopulate: true})
+	assert.Nil(t, err)
+	merged, err = MergeLegals(handwritten, kv)
+	assert.Nil(t, err)
+	assert.Equal(t, exp, merged)
+}
+
+func TestKeyVal_UnknownEmptyEntries(t *testing.T) {
+	kv, err := ProcessKVs([]string{"a", "b", "c", "d"}, []string{"1", "2", "3", "4"})
+	assert.Nil(t, err)
+
+	assert.ElementsMatch(t, []string{"c", "d"}, kv.Unknown("a,,b,"))
+	assert.ElementsMatch(t, []string{"d"}, kv.Unknown(",a,b*,c,"))
+}
+
+func TestCheckLegalsWarn(t *testing.T) {
+	const legalDefs = `
+host:required-yes
+server:required-no
+server:deprecated-use host
+verbose:deprecated-yes`
+
+	kv, err := ProcessKVs([]string{"host"}, []string{"localhost"})
+	assert.Nil(t, err)
+
+	warnings, err := CheckLegalsWarn(kv, legalDefs)
+	assert.Nil(t, err)
+	assert.Nil(t, warnings)
+
+	kv["server"] = Populate("localhost")
+	kv["verbose"] = Populate("yes")
+	warnings, err = CheckLegalsWarn(kv, legalDefs)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key server is deprecated: use host", "key verbose is deprecated"}, warnings)
+}
+
+func TestCheckLegals_Multiple(t *testing.T) {
+	const legalDefs = `
+tag:required-yes
+tag:multiple-yes
+tag:values-red,green,blue
+port:required-no
+port:multiple-yes
+port:type-int`
+
+	kv, err := ProcessKVs([]string{"tag", "tag", "tag", "port"}, []string{"red", "green", "blue", "80"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv, err = ProcessKVs([]string{"tag", "tag", "tag"}, []string{"red", "foo", "blue"})
+	assert.Nil(t, err)
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "illegal value foo for key tag (occurrence 2)")
+
+	kv, err = ProcessKVs([]string{"tag", "port", "port"}, []string{"red", "80", "http"})
+	assert.Nil(t, err)
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value to key port (occurrence 2) must be integer")
+}
+
+func TestKeyVal_Merge(t *testing.T) {
+	base, err := ProcessKVs([]string{"a", "b", "eqn", "eqn", "eqn"}, []string{"1", "2", "x=1", "y=2", "z=3"})
+	assert.Nil(t, err)
+
+	override, err := ProcessKVs([]string{"b", "c", "eqn", "eqn"}, []string{"20", "30", "p=1", "q=2"})
+	assert.Nil(t, err)
+
+	merged := base.Merge(override, MergeOverwrite)
+	assert.ElementsMatch(t, []string{"a", "b", "c", "eqn1", "eqn2"}, keysOf(merged))
+	assert.Equal(t, 20, *merged.Get("b").AsInt)
+	assert.Equal(t, []string{"p=1", "q=2"}, merged.GetMultipleTrim("eqn"))
+
+	merged = base.Merge(override, MergeKeep)
+	assert.ElementsMatch(t, []string{"a", "b", "c", "eqn1", "eqn2", "eqn3"}, keysOf(merged))
+	assert.Equal(t, 2, *merged.Get("b").AsInt)
+	assert.Equal(t, []string{"x=1", "y=2", "z=3"}, merged.GetMultipleTrim("eqn"))
+
+	merged = base.Merge(override, MergeAppend)
+	assert.ElementsMatch(t, []string{"a", "b1", "b2", "c", "eqn1", "eqn2", "eqn3", "eqn4", "eqn5"}, keysOf(merged))
+	assert.Equal(t, []string{"2", "20"}, merged.GetMultipleTrim("b"))
+	assert.Equal(t, []string{"x=1", "y=2", "z=3", "p=1", "q=2"}, merged.GetMultipleTrim("eqn"))
+
+	// the originals are untouched
+	assert.Equal(t, 2, *base.Get("b").AsInt)
+	assert.Nil(t, base.Get("c"))
+}
+
+// keysOf returns the keys of kv.
+func keysOf(kv KeyVal) []string {
+	var keys []string
+	for k := range kv {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+func TestApplyAliases(t *testing.T) {
+	const legalDefs = `
+host:required-yes
+host:alias-server
+eqn:required-no
+eqn:multiple-yes
+eqn:alias-equation`
+
+	kv, err := ProcessKVs([]string{"server", "equation", "equation"}, []string{"localhost", "a=b", "b=c"})
+	assert.Nil(t, err)
+
+	warnings, err := ApplyAliases(kv, legalDefs)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key server is an alias of key host", "key equation is an alias of key eqn"}, warnings)
+	assert.Equal(t, "localhost", kv.GetTrim("host"))
+	assert.Equal(t, []string{"a=b", "b=c"}, kv.GetMultipleTrim("eqn"))
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["server"] = Populate("otherhost")
+	_, err = ApplyAliases(kv, legalDefs)
+	assert.EqualError(t, err, "key host and its alias server are both present")
+}
+
+func TestKeyVal_GetBestMultiple(t *testing.T) {
+	kv, err := ProcessKVs([]string{"server", "server", "server"}, []string{"8080", "localhost", "3.5"})
+	assert.Nil(t, err)
+
+	data, dts := kv.GetBestMultiple("server")
+	assert.Equal(t, []DataType{Int, String, Float}, dts)
+	assert.Equal(t, 8080, *data[0].(*int))
+	assert.Equal(t, "localhost", data[1])
+	assert.Equal(t, 3.5, *data[2].(*float64))
+
+	data, dts = kv.GetBestMultiple("missing")
+	assert.Nil(t, data)
+	assert.Nil(t, dts)
+}
+
+func TestCheckLegals_Relation(t *testing.T) {
+	const legalDefs = `
+min:required-yes
+max:required-yes
+rate:required-no
+limits:relation-min<=max
+rates:relation-rate<max`
+
+	kv, err := ProcessKVs([]string{"min", "max"}, []string{"1", "10"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["min"] = Populate("20")
+	err = CheckLegals(kv, legalDefs)
+	assert.EqualError(t, err, "relation min<=max failed: min is 20, max is 10")
+	var ke *KeyError
+	assert.True(t, errors.As(err, &ke))
+	assert.Equal(t, "min", ke.Key)
+	assert.Equal(t, "min<=max", ke.Expected)
+	assert.Equal(t, "20", ke.Actual)
+
+	// a failed relation is a violation that severity-warn makes a warning
+	warns, err := CheckLegalsWarn(kv, legalDefs+"\nlimits:severity-warn")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"relation min<=max failed: min is 20, max is 10"}, warns)
+
+	kv["min"] = Populate("1")
+	kv["rate"] = Populate("10.5")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "relation rate<max failed: rate is 10.5, max is 10")
+
+	kv["rate"] = Populate("fast")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value fast for key rate must be numeric for relation rate<max")
+
+	// a relation needs two keys and an operator, which is checked when the legals are built
+	kv["rate"] = Populate("5")
+	for _, rel := range []string{"minmax", "<=max", "min<"} {
+		_, _, _, err = BuildLegals("r:relation-" + rel)
+		assert.EqualError(t, err, "bad relation "+rel+" for key r")
+		assert.EqualError(t, CheckLegals(kv, legalDefs+"\nbad:relation-"+rel), "bad relation "+rel+" for key bad")
+	}
+
+	_, _, _, err = BuildLegals("relation:min<=max")
+	assert.NotNil(t, err)
+}
+
+func TestReadKV_Continuation(t *testing.T) {
+	const content = `url: \
+  http://host:8080/path
+hosts: a, \
+   b:1, \
+   c:2
+last: x`
+
+	kv, err := ReadKVOpts("cont.txt", Options{IncludeResolver: func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(content)), nil
+	}})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"url", "hosts", "last"}, keysOf(kv))
+	assert.Equal(t, "http://host:8080/path", kv.GetTrim("url"))
+	assert.Equal(t, "a, b:1, c:2", kv.GetTrim("hosts"))
+	assert.Equal(t, "x", kv.GetTrim("last"))
+}
+
+func TestCheckLegalsOpts(t *testing.T) {
+	const legalDefs = `
+workers:required-yes
+workers:type-int`
+
+	opts := Options{Validators: map[string]func(*Value) error{
+		"workers": func(v *Value) error {
+			if *v.AsInt%2 != 0 {
+				return fmt.Errorf("workers must be even")
+			}
+			return nil
+		},
+	}}
+
+	kv, err := ProcessKVs([]string{"workers"}, []string{"4"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegalsOpts(kv, legalDefs, opts))
+
+	kv["workers"] = Populate("3")
+	assert.EqualError(t, CheckLegalsOpts(kv, legalDefs, opts), "workers must be even")
+
+	// the built-in checks run first
+	kv["workers"] = Populate("three")
+	assert.EqualError(t, CheckLegalsOpts(kv, legalDefs, opts), "value to key workers must be integer")
+}
+
+func TestPopulate_Numbers(t *testing.T) {
+	val := Populate("1e3")
+	assert.Equal(t, Float, val.BestType)
+	assert.Nil(t, val.AsInt)
+	assert.Equal(t, 1000.0, *val.AsFloat)
+
+	val = Populate("1_000")
+	assert.Equal(t, Int, val.BestType)
+	assert.Equal(t, 1000, *val.AsInt)
+
+	val = Populate("1_000.5")
+	assert.Equal(t, Float, val.BestType)
+	assert.Equal(t, 1000.5, *val.AsFloat)
+
+	for _, bad := range []string{"_1000", "1000_", "1__000", "1_e3"} {
+		assert.Equal(t, String, Populate(bad).BestType, bad)
+	}
+
+	val = Populate("1_000, 2_000, 3")
+	assert.Equal(t, SliceInt, val.BestType)
+	assert.Equal(t, []int{1000, 2000, 3}, val.AsSliceI)
+
+	val = Populate("1e3, 2.5e-1, 3")
+	assert.Equal(t, SliceFloat, val.BestType)
+	assert.Equal(t, []float64{1000, 0.25, 3}, val.AsSliceF)
+}
+
+func TestProcessKVsOpts_CaseInsensitive(t *testing.T) {
+	keys := []string{"Port", "port", "HOST"}
+	vals := []string{"80", "8080", "localhost"}
+
+	kv, err := ProcessKVsOpts(keys, vals, Options{CaseInsensitiveKeys: true})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"port1", "port2", "host"}, keysOf(kv))
+	assert.Nil(t, kv.Missing("port,host"))
+	assert.Equal(t, []string{"80", "8080"}, kv.GetMultipleTrim("port"))
+
+	// lookups ignore case
+	assert.Equal(t, "localhost", kv.GetTrim("Host"))
+	assert.Nil(t, kv.Missing("PORT,Host"))
+	assert.Equal(t, []string{"Host"}, kv.Present("Host"))
+	assert.Equal(t, []string{"80", "8080"}, kv.GetMultipleTrim("Port"))
+	assert.Nil(t, kv.Unknown("Port*,HOST"))
+	data, dt := kv.GetBest("Host")
+	assert.Equal(t, "localhost", data)
+	assert.Equal(t, String, dt)
+	_, dt = NewSafeKeyVal(kv).GetBest("HOST")
+	assert.Equal(t, String, dt)
+
+	kv, err = ProcessKVs(keys, vals)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"Port", "port", "HOST"}, keysOf(kv))
+	assert.Nil(t, kv.Get("host"))
+	assert.Equal(t, []string{"Host"}, kv.Missing("Host"))
+}
+
+func TestApplyDefaults(t *testing.T) {
+	const legalDefs = `
+host:required-yes
+host:default-localhost
+timeout:required-no
+timeout:type-int
+timeout:default-30
+url:required-no
+url:default-http://localhost:8080`
+
+	kv, err := ProcessKVs([]string{"url"}, []string{"http://host"})
+	assert.Nil(t, err)
+
+	assert.Nil(t, ApplyDefaults(kv, legalDefs))
+	assert.Equal(t, 30, *kv.Get("timeout").AsInt)
+	assert.Equal(t, Int, kv.Get("timeout").BestType)
+	assert.Equal(t, "http://host", kv.GetTrim("url"))
+
+	// required keys don't get defaults
+	assert.Nil(t, kv.Get("host"))
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "missing required key host")
+
+	delete(kv, "url")
+	assert.Nil(t, ApplyDefaults(kv, legalDefs))
+	assert.Equal(t, "http://localhost:8080", kv.GetTrim("url"))
+}
+
+func TestValue_Text(t *testing.T) {
+	for _, str := range []string{"hello", "42", "a, b", "2023-10-15", `"quoted, string"`, ""} {
+		text, err := Populate(str).MarshalText()
+		assert.Nil(t, err)
+		assert.Equal(t, str, string(text))
+
+		v := &Value{}
+		assert.Nil(t, v.UnmarshalText(text))
+		assert.Equal(t, Populate(str), v)
+	}
+
+	// the Value works with flag.TextVar
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := Populate("80")
+	fs.TextVar(port, "port", Populate("80"), "port to listen on")
+	assert.Nil(t, fs.Parse([]string{"-port", "8080"}))
+	assert.Equal(t, 8080, *port.AsInt)
+}
+
+func TestValue_String(t *testing.T) {
+	inVals := []string{"hello", "42", "3.14", "20231015", "a, b", "1,2", "1.5,2", "20231015, 20231016", "2023-10-15T14:30:00Z"}
+	exp := []string{"hello", "42", "3.14", "2023-10-15", "[a b]", "[1 2]", "[1.5 2]", "[2023-10-15 2023-10-16]",
+		"2023-10-15T14:30:00Z"}
+
+	for ind, val := range inVals {
+		assert.Equal(t, exp[ind], Populate(val).String())
+	}
+
+	var v *Value
+	assert.Equal(t, "<nil>", v.String())
+	assert.Equal(t, "42", fmt.Sprint(Populate("42")))
+}
+
+func TestReadKVString(t *testing.T) {
+	kv, err := ReadKVString(`// defaults
+name: app
+ports: 80, 443  // web
+rate: 0.5
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, "app", kv.GetTrim("name"))
+	assert.Equal(t, []int{80, 443}, kv.Get("ports").AsSliceI)
+	assert.Equal(t, 0.5, *kv.Get("rate").AsFloat)
+
+	_, err = ReadKVString("name app")
+	assert.EqualError(t, err, "bad key val: name app in file <string>, line 1")
+}
+
+func TestReadKVOpts_CommentPrefix(t *testing.T) {
+	files := map[string]string{
+		"hash.txt":  "# settings\nname: app  # the name\ncolor: \"#fff\"\nurl: http://host/#top\n",
+		"slash.txt": "// settings\nname: app  // the name\nurl: \"http://x\"  // quoted\nsite: http://host\n",
+	}
+	resolver := func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(files[name])), nil
+	}
+
+	kv, err := ReadKVOpts("hash.txt", Options{IncludeResolver: resolver, CommentPrefix: "#"})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"name", "color", "url"}, keysOf(kv))
+	assert.Equal(t, "app", kv.GetTrim("name"))
+	assert.Equal(t, "#fff", kv.GetTrim("color"))
+	assert.Equal(t, "http://host/#top", kv.GetTrim("url"))
+
+	kv, err = ReadKVOpts("slash.txt", Options{IncludeResolver: resolver})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"name", "url", "site"}, keysOf(kv))
+	assert.Equal(t, "app", kv.GetTrim("name"))
+	assert.Equal(t, "http://x", kv.GetTrim("url"))
+	assert.Equal(t, "http://host", kv.GetTrim("site"))
+}
+
+func TestCheckLegals_Match(t *testing.T) {
+	const legalDefs = `
+version:required-yes
+version:match-^v\d+\.\d+\.\d+$
+id:required-no
+id:match-^[a-z]+-[0-9]+$`
+
+	kv, err := ProcessKVs([]string{"version", "id"}, []string{"v1.2.3", "abc-12"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["version"] = Populate("1.2.3")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), `value 1.2.3 for key version does not match pattern ^v\d+\.\d+\.\d+$`)
+
+	kv["version"] = Populate("v1.2.3")
+	kv["id"] = Populate("abc12")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value abc12 for key id does not match pattern ^[a-z]+-[0-9]+$")
+}
+
+func TestPopulate_DateTime(t *testing.T) {
+	inDts := []string{"2023-10-15 14:30:00", "2023-10-15 14:30", "10/15/2023 14:30:05", "2023-10-15T14:30:00Z",
+		"2023-10-15T14:30:00"}
+	exp := []time.Time{
+		time.Date(2023, 10, 15, 14, 30, 0, 0, time.UTC),
+		time.Date(2023, 10, 15, 14, 30, 0, 0, time.UTC),
+		time.Date(2023, 10, 15, 14, 30, 5, 0, time.UTC),
+		time.Date(2023, 10, 15, 14, 30, 0, 0, time.UTC),
+		time.Date(2023, 10, 15, 14, 30, 0, 0, time.UTC),
+	}
+
+	for ind, dtStr := range inDts {
+		val := Populate(dtStr)
+		assert.Equal(t, Date, val.BestType, dtStr)
+		assert.True(t, exp[ind].Equal(*val.AsDate), dtStr)
+	}
+}
+
+func TestValue_GetAs(t *testing.T) {
+	val := Populate("42")
+
+	data, err := val.GetAs(Float)
+	assert.Nil(t, err)
+	assert.Equal(t, 42.0, *data.(*float64))
+
+	data, err = val.GetAs(String)
+	assert.Nil(t, err)
+	assert.Equal(t, "42", data)
+
+	_, err = val.GetAs(Date)
+	assert.EqualError(t, err, "value cannot be represented as Date")
+
+	// a Value built by hand
+	i := 3
+	val = &Value{AsString: "3", AsInt: &i, AsSliceI: []int{3}, BestType: Int}
+	data, err = val.GetAs(Float)
+	assert.Nil(t, err)
+	assert.Equal(t, 3.0, *data.(*float64))
+
+	data, err = val.GetAs(SliceFloat)
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{3}, data)
+
+	_, err = Populate("hello").GetAs(Int)
+	assert.EqualError(t, err, "value cannot be represented as Int")
+}
+
+func TestBuildLegals_Malformed(t *testing.T) {
+	_, _, _, err := BuildLegals("key1:required-yes\nkey1 required-yes")
+	assert.EqualError(t, err, `bad legal definition "key1 required-yes": must be key:field-value`)
+
+	_, _, _, err = BuildLegals("key2:type")
+	assert.EqualError(t, err, `bad legal definition "key2:type": must be key:field-value`)
+
+	_, _, _, err = BuildLegals("key:requried-yes")
+	assert.EqualError(t, err, `unknown legal field "requried" for key key`)
+
+	kv, err := ProcessKVs([]string{"key"}, []string{"1"})
+	assert.Nil(t, err)
+	assert.EqualError(t, CheckLegals(kv, "key:requried-yes"), `unknown legal field "requried" for key key`)
+
+	kl, fl, vl, err := BuildLegals("\nkey:required-yes\n  \nkey:min--1\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key", "key"}, kl)
+	assert.Equal(t, []string{"required", "min"}, fl)
+	assert.Equal(t, []string{"yes", "-1"}, vl)
+}
+
+func TestPopulate_Empty(t *testing.T) {
+	kv, err := ReadKVString("name:\nother: \nlast: x\n")
+	assert.Nil(t, err)
+
+	for _, key := range []string{"name", "other"} {
+		val := kv.Get(key)
+		assert.NotNil(t, val)
+		assert.True(t, val.IsEmpty())
+		assert.Equal(t, "", val.AsString)
+		assert.Equal(t, String, val.BestType)
+		assert.Nil(t, val.AsSliceS)
+		assert.Nil(t, val.AsSliceI)
+		assert.Nil(t, val.AsSliceF)
+		assert.Nil(t, val.AsSliceD)
+	}
+
+	assert.False(t, kv.Get("last").IsEmpty())
+	assert.Nil(t, kv.Get("missing"))
+	assert.True(t, kv.Get("missing").IsEmpty())
+	assert.True(t, Populate(" \t").IsEmpty())
+}
+
+func TestReadKV_GlobInclude(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.Mkdir(dir+"/conf.d", 0755))
+	assert.Nil(t, os.WriteFile(dir+"/conf.d/b.txt", []byte("eqn: b\n"), 0644))
+	assert.Nil(t, os.WriteFile(dir+"/conf.d/a.txt", []byte("eqn: a\n"), 0644))
+	assert.Nil(t, os.WriteFile(dir+"/conf.d/c.dat", []byte("eqn: c\n"), 0644))
+	// patterns are relative to the directory of the file with the include
+	assert.Nil(t, os.WriteFile(dir+"/main.txt", []byte("x: 1\ninclude: conf.d/*.txt\ny: 2\n"), 0644))
+	assert.Nil(t, os.WriteFile(dir+"/none.txt", []byte("x: 1\ninclude: conf.d/*.kv\n"), 0644))
+	assert.Nil(t, os.WriteFile(dir+"/abs.txt", []byte("include: "+dir+"/conf.d/a.*\n"), 0644))
+
+	kv, err := ReadKV(dir + "/main.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, kv.GetMultipleTrim("eqn"))
+	assert.Equal(t, "2", kv.GetTrim("y"))
+
+	_, err = ReadKV(dir + "/none.txt")
+	assert.EqualError(t, err, fmt.Sprintf("include %s/conf.d/*.kv in file %s/none.txt matches no files", dir, dir))
+
+	kv, err = ReadKV(dir + "/abs.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, kv.GetMultipleTrim("eqn"))
+
+	// a resolver is given the pattern
+	var asked []string
+	resolver := func(name string) (io.ReadCloser, error) {
+		asked = append(asked, name)
+		return os.Open(dir + "/" + name)
+	}
+	_, err = ReadKVOpts("main.txt", Options{IncludeResolver: resolver})
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"main.txt", "conf.d/*.txt"}, asked)
+}
+
+func TestReadKV_MultiCharDelim(t *testing.T) {
+	KVDelim = "=>"
+	defer func() { KVDelim = ":" }()
+
+	kv, err := ReadKVString(`start => 12:30
+url => http://host:8080/path
+hosts => a:1, b:2,
+  c:3
+port => 80
+`)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"start", "url", "hosts", "port"}, keysOf(kv))
+	assert.Equal(t, "12:30", kv.GetTrim("start"))
+	assert.Equal(t, "http://host:8080/path", kv.GetTrim("url"))
+	assert.Equal(t, []string{"a:1", "b:2", "c:3"}, kv.Get("hosts").AsSliceS)
+	assert.Equal(t, 80, *kv.Get("port").AsInt)
+}
+
+func TestKeyVal_Subset(t *testing.T) {
+	kv, err := ProcessKVs([]string{"db.host", "db.port", "cache.ttl"}, []string{"localhost", "5432", "60"})
+	assert.Nil(t, err)
+
+	db := kv.Subset("db.", true)
+	assert.ElementsMatch(t, []string{"host", "port"}, keysOf(db))
+	assert.Equal(t, 5432, *db.Get("port").AsInt)
+
+	db = kv.Subset("db.", false)
+	assert.ElementsMatch(t, []string{"db.host", "db.port"}, keysOf(db))
+
+	// the subset is independent of kv
+	*db.Get("db.port").AsInt = 1
+	db["db.user"] = Populate("me")
+	delete(db, "db.host")
+	assert.Equal(t, 5432, *kv.Get("db.port").AsInt)
+	assert.Nil(t, kv.Get("db.user"))
+	assert.NotNil(t, kv.Get("db.host"))
+
+	all := kv.Subset("", false)
+	assert.ElementsMatch(t, keysOf(kv), keysOf(all))
+	assert.Equal(t, kv.Get("cache.ttl"), all.Get("cache.ttl"))
+}
+
+func TestCheckLegals_Values(t *testing.T) {
+	const legalDefs = `
+colors:required-yes
+colors:values-red, green, blue
+level:required-no
+level:type-int
+level:values-1,2,3`
+
+	kv, err := ProcessKVs([]string{"colors", "level"}, []string{"red, blue", "02"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["colors"] = Populate("red, purple, green")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "illegal value purple for key colors")
+
+	kv["colors"] = Populate("green")
+	kv["level"] = Populate("4")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "illegal value 4 for key level")
+}
+
+func TestValue_Append(t *testing.T) {
+	val := Populate("1")
+	assert.Equal(t, Int, val.BestType)
+	val.AppendInt(2)
+	assert.Equal(t, SliceInt, val.BestType)
+	assert.Equal(t, []int{1, 2}, val.AsSliceI)
+	assert.Equal(t, []float64{1, 2}, val.AsSliceF)
+
+	val.AppendFloat(2.5)
+	assert.Equal(t, SliceFloat, val.BestType)
+	assert.Equal(t, []float64{1, 2, 2.5}, val.AsSliceF)
+	assert.Nil(t, val.AsSliceI)
+
+	val.AppendString("path")
+	assert.Equal(t, SliceStr, val.BestType)
+	assert.Equal(t, []string{"1", "2", "2.5", "path"}, val.AsSliceS)
+
+	val = Populate("20230101").AppendDate(time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, SliceDate, val.BestType)
+	assert.Len(t, val.AsSliceD, 2)
+
+	val = Populate("").AppendString("only")
+	assert.Equal(t, String, val.BestType)
+	assert.Equal(t, "only", val.AsString)
+
+	// a quoted string stays one element
+	val = Populate(`"a, b"`).AppendString("c")
+	assert.Equal(t, SliceStr, val.BestType)
+	assert.Equal(t, []string{"a, b", "c"}, val.AsSliceS)
+	val.AppendInt(1)
+	assert.Equal(t, []string{"a, b", "c", "1"}, val.AsSliceS)
+	assert.Nil(t, val.AsSliceI)
+}
+
+func TestProcessKVsOpts_ResolveRefs(t *testing.T) {
+	opts := Options{ResolveRefs: true}
+
+	keys := []string{"logs", "base", "count", "total", "plain"}
+	vals := []string{"%{base}/logs", "/opt/app", "%{total}0", "4", "100%"}
+	kv, err := ProcessKVsOpts(keys, vals, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "/opt/app/logs", kv.GetTrim("logs"))
+	assert.Equal(t, 40, *kv.Get("count").AsInt)
+	assert.Equal(t, Int, kv.Get("count").BestType)
+	assert.Equal(t, "100%", kv.GetTrim("plain"))
+
+	_, err = ProcessKVsOpts([]string{"a", "b"}, []string{"%{b}", "x%{a}"}, opts)
+	assert.EqualError(t, err, "reference cycle: a -> b -> a")
+
+	_, err = ProcessKVsOpts([]string{"a"}, []string{"%{b}"}, opts)
+	assert.EqualError(t, err, "key a references missing key b")
+
+	// without the option, references are left alone
+	kv, err = ProcessKVs(keys, vals)
+	assert.Nil(t, err)
+	assert.Equal(t, "%{base}/logs", kv.GetTrim("logs"))
+}
+
+func TestReadKVFromReader(t *testing.T) {
+	kv, err := ReadKVFromReader(strings.NewReader("a: 1\nb: x, y\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, *kv.Get("a").AsInt)
+	assert.Equal(t, []string{"x", "y"}, kv.Get("b").AsSliceS)
+
+	keys, vals, err := ReadKV2SlcFromReader(strings.NewReader("a: 1\na: 2\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "a"}, keys)
+	assert.Equal(t, []string{"1", "2"}, vals)
+
+	_, err = ReadKVFromReader(strings.NewReader("oops"))
+	assert.EqualError(t, err, "bad key val: oops in file <reader>, line 1")
+}
+
+func TestParseString(t *testing.T) {
+	kv, err := ParseString("a: 1  // one\nb: two\n")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, *kv.Get("a").AsInt)
+	assert.Equal(t, "two", kv.GetTrim("b"))
+}
+
+func TestReadKV_ParseError(t *testing.T) {
+	files := map[string]string{
+		"main.txt": "// main\na: 1\ninclude: sub.txt\n",
+		"sub.txt":  "// sub\n\nb: 2\nc: 3\n",
+	}
+	opts := Options{IncludeResolver: func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(files[name])), nil
+	}}
+
+	_, err := ReadKVOpts("main.txt", opts)
+	assert.Nil(t, err)
+
+	files["sub.txt"] = "// sub\n\nno delimiter here\n"
+	_, err = ReadKVOpts("main.txt", opts)
+
+	var pe *ParseError
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, ParseError{File: "sub.txt", Line: 3, Text: "no delimiter here"}, *pe)
+	assert.EqualError(t, err, "bad key val: no delimiter here in file sub.txt, line 3")
+}
+
+func TestCheckLegalsAll(t *testing.T) {
+	const legalDefs = `
+host:required-yes
+port:required-no
+port:type-int
+color:required-no
+color:values-red,green
+old:required-no
+old:deprecated-yes`
+
+	kv, err := ProcessKVs([]string{"port", "color", "old", "extra"}, []string{"eighty", "blue", "1", "x"})
+	assert.Nil(t, err)
+
+	report := CheckLegalsAll(kv, legalDefs)
+	assert.False(t, report.OK())
+	assert.Len(t, report.Errors, 4)
+	assert.Equal(t, "missing required key host", report.Errors[0].Error())
+	assert.Equal(t, "unknown key(s): [extra]", report.Errors[3].Error())
+	assert.Equal(t, []string{"key old is deprecated"}, report.Warnings)
+
+	// CheckLegals stops at the first
+	assert.Equal(t, report.Errors[0], CheckLegals(kv, legalDefs))
+
+	kv, err = ProcessKVs([]string{"host", "port"}, []string{"localhost", "80"})
+	assert.Nil(t, err)
+	assert.True(t, CheckLegalsAll(kv, legalDefs).OK())
+
+	report = CheckLegalsAll(kv, "host:bogus-yes")
+	assert.Len(t, report.Errors, 1)
+}
+
+func TestCheckLegals_Severity(t *testing.T) {
+	const legalDefs = `
+host:required-yes
+port:required-no
+port:type-int
+port:severity-warn
+*:unknown-warn`
+
+	kv, err := ProcessKVs([]string{"host", "port", "extra"}, []string{"localhost", "eighty", "x"})
+	assert.Nil(t, err)
+
+	report := CheckLegalsAll(kv, legalDefs)
+	assert.True(t, report.OK())
+	assert.Equal(t, []string{"value to key port must be integer", "unknown key(s): [extra]"}, report.Warnings)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	warnings, err := CheckLegalsWarn(kv, legalDefs)
+	assert.Nil(t, err)
+	assert.Len(t, warnings, 2)
+
+	// ignored unknown keys are not reported at all
+	report = CheckLegalsAll(kv, strings.Replace(legalDefs, "unknown-warn", "unknown-ignore", 1))
+	assert.Equal(t, []string{"value to key port must be integer"}, report.Warnings)
+
+	// errors by other keys are still errors
+	delete(kv, "host")
+	report = CheckLegalsAll(kv, legalDefs)
+	assert.Len(t, report.Errors, 1)
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "missing required key host")
+}
+
+func TestPopulate_Bool(t *testing.T) {
+	for _, str := range []string{"true", "Yes", "ON", " true "} {
+		val := Populate(str)
+		assert.Equal(t, Bool, val.BestType, str)
+		assert.True(t, *val.AsBool, str)
+	}
+
+	for _, str := range []string{"false", "NO", "off"} {
+		val := Populate(str)
+		assert.Equal(t, Bool, val.BestType, str)
+		assert.False(t, *val.AsBool, str)
+	}
+
+	val := Populate("1")
+	assert.Nil(t, val.AsBool)
+
+	val = Populate("yes, off, True")
+	assert.Equal(t, SliceBool, val.BestType)
+	assert.Equal(t, []bool{true, false, true}, val.AsSliceB)
+	assert.Equal(t, "[true false true]", val.String())
+
+	kv, err := ProcessKVs([]string{"debug"}, []string{"maybe"})
+	assert.Nil(t, err)
+	assert.Equal(t, "value to key debug must be bool", CheckLegals(kv, "debug:required-yes\ndebug:type-bool").Error())
+
+	kv["debug"] = Populate("on")
+	assert.Nil(t, CheckLegals(kv, "debug:required-yes\ndebug:type-bool"))
+}
+
+func TestPopulate_Duration(t *testing.T) {
+	val := Populate("2h45m")
+	assert.Equal(t, Duration, val.BestType)
+	assert.Equal(t, 2*time.Hour+45*time.Minute, *val.AsDuration)
+	assert.Equal(t, "2h45m0s", val.String())
+
+	// a plain number is not a duration
+	val = Populate("0")
+	assert.Nil(t, val.AsDuration)
+	assert.Equal(t, Int, val.BestType)
+
+	val = Populate("30s, 15m")
+	assert.Equal(t, SliceDuration, val.BestType)
+	assert.Equal(t, []time.Duration{30 * time.Second, 15 * time.Minute}, val.AsSliceDur)
+
+	kv, err := ProcessKVs([]string{"timeout"}, []string{"soon"})
+	assert.Nil(t, err)
+	assert.Equal(t, "value to key timeout must be duration",
+		CheckLegals(kv, "timeout:required-yes\ntimeout:type-duration").Error())
+}
+
+func TestPopulate_ByteSize(t *testing.T) {
+	val := Populate("512MB")
+	assert.Equal(t, ByteSize, val.BestType)
+	assert.Equal(t, int64(512e6), *val.AsBytes)
+	assert.Equal(t, "512MB", val.String())
+
+	assert.Equal(t, int64(2<<30), *Populate("2GiB").AsBytes)
+	assert.Equal(t, int64(1536), *Populate("1.5 kib").AsBytes)
+	assert.Equal(t, int64(10), *Populate("10b").AsBytes)
+
+	// a plain number, an unknown unit, a negative size and an overflow are not byte sizes
+	for _, str := range []string{"512", "512XB", "-1MB", "10000PiB", "MB"} {
+		assert.Nil(t, Populate(str).AsBytes, str)
+	}
+
+	legals := "mem:required-yes\nmem:type-bytes\nmem:min-1MiB\nmem:max-1000000000"
+	kv, err := ProcessKVs([]string{"mem"}, []string{"512MB"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legals))
+
+	kv["mem"] = Populate("2GiB")
+	assert.Equal(t, "value 2GiB for key mem exceeds max 1000000000", CheckLegals(kv, legals).Error())
+
+	kv["mem"] = Populate("1000kB")
+	assert.ErrorIs(t, CheckLegals(kv, legals), ErrIllegalValue)
+
+	kv["mem"] = Populate("lots")
+	assert.Equal(t, "value to key mem must be a byte size", CheckLegals(kv, legals).Error())
+}
+
+func TestPopulate_Decimal(t *testing.T) {
+	kv, err := ProcessKVsOpts([]string{"price", "qty", "rate", "name"}, []string{"19.99", "3", "1e-2", "x"},
+		Options{Decimal: true})
+	assert.Nil(t, err)
+
+	assert.Equal(t, Decimal, kv["price"].BestType)
+	assert.Equal(t, big.NewRat(1999, 100), kv["price"].AsDecimal)
+	assert.Equal(t, 19.99, *kv["price"].AsFloat)
+	assert.Equal(t, "19.99", kv["price"].String())
+	assert.Equal(t, Int, kv["qty"].BestType)
+	assert.Equal(t, big.NewRat(3, 1), kv["qty"].AsDecimal)
+	assert.Equal(t, big.NewRat(1, 100), kv["rate"].AsDecimal)
+	assert.Nil(t, kv["name"].AsDecimal)
+
+	// the sum is exact, unlike float64
+	sum := new(big.Rat).Add(big.NewRat(1, 10), kv.GetDecimal("price", nil))
+	assert.Equal(t, "20.09", sum.FloatString(2))
+	assert.Equal(t, "20.090000000000", sum.FloatString(12))
+
+	lazy, err := ProcessKVsOpts([]string{"price"}, []string{"19.99"}, Options{Decimal: true, LazyPopulate: true})
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewRat(1999, 100), lazy.MustGetDecimal("price"))
+
+	// decimals are opt-in
+	assert.Nil(t, Populate("19.99").AsDecimal)
+	assert.Equal(t, Float, Populate("19.99").BestType)
+	for _, str := range []string{"1/3", "inf", "0x1p-2"} {
+		assert.Nil(t, toDecimal(str), str)
+	}
+
+	legals := "price:required-yes\nprice:type-decimal\nprice:min-0.01\nprice:max-19.99"
+	assert.Nil(t, CheckLegals(KeyVal{"price": kv["price"]}, legals))
+	assert.Nil(t, CheckLegals(KeyVal{"price": Populate("19.99")}, legals))
+
+	kv, err = ProcessKVsOpts([]string{"price"}, []string{"19.991"}, Options{Decimal: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "value 19.991 for key price exceeds max 19.99", CheckLegals(kv, legals).Error())
+
+	kv["price"] = Populate("cheap")
+	assert.Equal(t, "value to key price must be decimal", CheckLegals(kv, legals).Error())
+}
+
+func TestPopulate_Percent(t *testing.T) {
+	val := Populate("75%")
+	assert.Equal(t, Percent, val.BestType)
+	assert.Equal(t, 0.75, *val.AsPercent)
+	assert.Nil(t, val.AsFloat)
+	assert.Equal(t, "75%", val.String())
+	assert.Equal(t, 0.125, *Populate(" 12.5 %").AsPercent)
+
+	for _, str := range []string{"75", "%", "x%"} {
+		assert.Nil(t, Populate(str).AsPercent, str)
+	}
+
+	val = Populate("10%, 50%")
+	assert.Equal(t, SlicePercent, val.BestType)
+	assert.Equal(t, []float64{0.1, 0.5}, val.AsSlicePct)
+	assert.Equal(t, "[10% 50%]", val.String())
+
+	legals := "load:required-yes\nload:type-percent\nload:min-10%\nload:max-0.9\nsplits:required-no\nsplits:type-slicepercent"
+	kv, err := ProcessKVs([]string{"load", "splits"}, []string{"75%", "10%, 90%"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legals))
+
+	kv["load"] = Populate("95%")
+	assert.Equal(t, "value 95% for key load exceeds max 0.9", CheckLegals(kv, legals).Error())
+
+	kv["load"] = Populate("5%")
+	assert.ErrorIs(t, CheckLegals(kv, legals), ErrIllegalValue)
+
+	kv["load"] = Populate("0.5")
+	assert.Equal(t, "value to key load must be percent", CheckLegals(kv, legals).Error())
+
+	kv["load"], kv["splits"] = Populate("50%"), Populate("10%, 0.9")
+	assert.Equal(t, "value to key splits must be a slice of percent", CheckLegals(kv, legals).Error())
+}
+
+func TestRegisterDateFormat(t *testing.T) {
+	assert.Nil(t, Populate("2023.10.15").AsDate)
+
+	// the registry is global, so put it back for other tests and for -count
+	saved := append([]string(nil), dateFormats.layouts...)
+	t.Cleanup(func() {
+		dateFormats.mu.Lock()
+		defer dateFormats.mu.Unlock()
+		dateFormats.layouts = saved
+	})
+
+	RegisterDateFormat("2006.01.02")
+	RegisterDateFormat("2006.01.02")
+	assert.Equal(t, []string{"2006.01.02"}, dateFormats.layouts)
+
+	val := Populate("2023.10.15")
+	assert.Equal(t, Date, val.BestType)
+	assert.Equal(t, time.Date(2023, 10, 15, 0, 0, 0, 0, time.UTC), *val.AsDate)
+}
+
+func TestPopulate_Quoted(t *testing.T) {
+	kv, err := ReadKVString(`list: "a, b" // one string
+url: "http://host // not a comment"
+esc: "tab\there \"quoted\"\nback\\slash"
+num: "42"
+`)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "a, b", kv.Get("list").AsString)
+	assert.Nil(t, kv.Get("list").AsSliceS)
+	assert.Equal(t, String, kv.Get("list").BestType)
+	assert.Equal(t, "http://host // not a comment", kv.Get("url").AsString)
+	assert.Equal(t, "tab\there \"quoted\"\nback\\slash", kv.Get("esc").AsString)
+	assert.Nil(t, kv.Get("num").AsInt)
+
+	// not a quoted string
+	assert.Equal(t, SliceStr, Populate(`"a", "b"`).BestType)
+}
+
+func TestReadKV_Block(t *testing.T) {
+	kv, err := ReadKVString(`name: app
+script: <<END
+  echo "a, b" // kept
+key: not a key
+END
+after: 1
+`)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"name", "script", "after"}, keysOf(kv))
+	assert.Equal(t, "  echo \"a, b\" // kept\nkey: not a key", kv.Get("script").AsString)
+	assert.Equal(t, String, kv.Get("script").BestType)
+	assert.Equal(t, 1, *kv.Get("after").AsInt)
+
+	_, err = ReadKVString("script: <<EOT\nline\n")
+	assert.Equal(t, "bad key val: block EOT is not ended in file <string>, line 1", err.Error())
+}
+
+func TestProcessKVsOpts_ExpandEnv(t *testing.T) {
+	t.Setenv("KV_HOME", "/home/kv")
+	t.Setenv("KV_EMPTY", "")
+
+	keys := []string{"logs", "level", "empty", "port", "literal"}
+	vals := []string{"${KV_HOME}/logs", "${KV_UNSET_VAR:-info}", "${KV_EMPTY:-x}${KV_UNSET_VAR}", "${KV_PORT:-8080}",
+		"$KV_HOME"}
+
+	kv, err := ProcessKVsOpts(keys, vals, Options{ExpandEnv: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "/home/kv/logs", kv.Get("logs").AsString)
+	assert.Equal(t, "info", kv.Get("level").AsString)
+	assert.Equal(t, "x", kv.Get("empty").AsString)
+	assert.Equal(t, 8080, *kv.Get("port").AsInt)
+	assert.Equal(t, "$KV_HOME", kv.Get("literal").AsString)
+
+	kv, err = ProcessKVs(keys, vals)
+	assert.Nil(t, err)
+	assert.Equal(t, "${KV_HOME}/logs", kv.Get("logs").AsString)
+}
+
+func TestProcessKVsOpts_DollarRefs(t *testing.T) {
+	t.Setenv("KV_ROOT", "/env")
+	t.Setenv("basedir", "/from/env")
+
+	keys := []string{"logdir", "basedir", "home"}
+	vals := []string{"${basedir}/logs", "${KV_ROOT}/app", "%{basedir}"}
+
+	// the key basedir takes precedence over the environment variable
+	kv, err := ProcessKVsOpts(keys, vals, Options{ResolveRefs: true, ExpandEnv: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "/env/app/logs", kv.GetTrim("logdir"))
+	assert.Equal(t, "/env/app", kv.GetTrim("home"))
+
+	kv, err = ProcessKVsOpts(keys, vals, Options{ExpandEnv: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "/from/env/logs", kv.GetTrim("logdir"))
+
+	_, err = ProcessKVsOpts([]string{"a", "b"}, []string{"${b}", "${a}"}, Options{ResolveRefs: true})
+	assert.EqualError(t, err, "reference cycle: a -> b -> a")
+
+	// a ${...} that isn't a key is left alone, but a default is used
+	keys = []string{"a", "b", "c", "d", "e"}
+	vals = []string{"${HOME}/x", "${X:-y}/z", "${a:-q}", "${e:-none}", ""}
+	kv, err = ProcessKVsOpts(keys, vals, Options{ResolveRefs: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "${HOME}/x", kv.GetTrim("a"))
+	assert.Equal(t, "y/z", kv.GetTrim("b"))
+	assert.Equal(t, "${HOME}/x", kv.GetTrim("c"))
+	assert.Equal(t, "none", kv.GetTrim("d"))
+
+	_, err = ProcessKVsOpts([]string{"a"}, []string{"%{HOME}"}, Options{ResolveRefs: true})
+	assert.EqualError(t, err, "key a references missing key HOME")
+	kv, err = ProcessKVsOpts([]string{"a"}, []string{"%{HOME:-~}"}, Options{ResolveRefs: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "~", kv.GetTrim("a"))
+}
+
+func TestReadKV_IncludeCycle(t *testing.T) {
+	files := map[string]string{
+		"a.txt":    "x: 1\ninclude: b.txt\n",
+		"b.txt":    "y: 2\ninclude: a.txt\n",
+		"self.txt": "include: self.txt\n",
+		"d1.txt":   "include: d2.txt\n",
+		"d2.txt":   "include: d3.txt\n",
+		"d3.txt":   "z: 3\n",
+	}
+	resolver := func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(files[name])), nil
+	}
+
+	_, err := ReadKVOpts("a.txt", Options{IncludeResolver: resolver})
+	assert.EqualError(t, err, "include cycle: a.txt -> b.txt -> a.txt")
+
+	_, err = ReadKVOpts("self.txt", Options{IncludeResolver: resolver})
+	assert.EqualError(t, err, "include cycle: self.txt -> self.txt")
+
+	kv, err := ReadKVOpts("d1.txt", Options{IncludeResolver: resolver, MaxIncludeDepth: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, "3", kv.GetTrim("z"))
+
+	_, err = ReadKVOpts("d1.txt", Options{IncludeResolver: resolver, MaxIncludeDepth: 1})
+	assert.EqualError(t, err, "include depth exceeds 1: d1.txt -> d2.txt -> d3.txt")
+}
+
+func TestReadKV_HTTPInclude(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/base.kv" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = fmt.Fprint(w, "host: config.example.com\n")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(dir+"/main.txt", []byte("port: 80\ninclude: "+srv.URL+"/base.kv\n"), 0644))
+	assert.Nil(t, os.WriteFile(dir+"/bad.txt", []byte("include: "+srv.URL+"/missing.kv\n"), 0644))
+
+	kv, err := ReadKVOpts(dir+"/main.txt", Options{HTTPClient: &http.Client{Timeout: 5 * time.Second}})
+	assert.Nil(t, err)
+	assert.Equal(t, "config.example.com", kv.GetTrim("host"))
+
+	_, err = ReadKV(dir + "/main.txt")
+	assert.EqualError(t, err, "include "+srv.URL+"/base.kv requires an HTTPClient in Options")
+
+	_, err = ReadKVOpts(dir+"/bad.txt", Options{HTTPClient: srv.Client()})
+	assert.EqualError(t, err, "include "+srv.URL+"/missing.kv: 404 Not Found")
+}
+
+func TestReadKVContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// never answer, so only the context ends the request
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(dir+"/main.txt", []byte("port: 80\ninclude: "+srv.URL+"/base.kv\n"), 0644))
+	assert.Nil(t, os.WriteFile(dir+"/local.txt", []byte("port: 80\n"), 0644))
+
+	kv, err := ReadKVContext(context.Background(), dir+"/local.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, 80, *kv.Get("port").AsInt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = ReadKVOptsContext(ctx, dir+"/main.txt", Options{HTTPClient: srv.Client()})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ReadKVContext(canceled, dir+"/local.txt")
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	p, err := NewParser("port:required-yes")
+	assert.Nil(t, err)
+	_, err = p.ParseFileContext(canceled, dir+"/local.txt")
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, _, err = NewLoader(nil, Options{}).File(dir + "/local.txt").LoadContext(canceled)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestReadKV_IncludeIf(t *testing.T) {
+	t.Setenv("KV_STAGE", "prod")
+	files := map[string]string{
+		"main.txt": `env: dev
+include-if: $KV_STAGE==prod, prod.txt
+include-if: $KV_STAGE!=prod, test.txt
+include-if: env==dev, dev.txt
+include-if: $KV_UNSET_VAR, unset.txt
+include-if: env, any.txt
+`,
+		"prod.txt":  "prod: yes\n",
+		"test.txt":  "test: yes\n",
+		"dev.txt":   "dev: yes\n",
+		"unset.txt": "unset: yes\n",
+		"any.txt":   "any: yes\n",
+		"bad.txt":   "include-if: env\n",
+	}
+	resolver := func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(files[name])), nil
+	}
+
+	kv, err := ReadKVOpts("main.txt", Options{IncludeResolver: resolver})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"env", "prod", "dev", "any"}, keysOf(kv))
+
+	_, err = ReadKVOpts("bad.txt", Options{IncludeResolver: resolver})
+	assert.EqualError(t, err, "bad key val: include-if: env in file bad.txt, line 1")
+}
+
+func TestKeyVal_Sub(t *testing.T) {
+	kv, err := ReadKVString("db.host: localhost\ndb.port: 5432\ndb.primary.user: admin\ndbx: 1\nname: app\n")
+	assert.Nil(t, err)
+
+	db := kv.Sub("db")
+	assert.ElementsMatch(t, []string{"host", "port", "primary.user"}, keysOf(db))
+	assert.Equal(t, 5432, *db.Get("port").AsInt)
+	assert.Equal(t, "admin", db.Sub("primary").GetTrim("user"))
+	assert.Equal(t, kv.Sub("db.primary"), db.Sub("primary"))
+	assert.Empty(t, kv.Sub("cache"))
+}
+
+func TestKeyVal_Clone(t *testing.T) {
+	kv, err := ReadKVString("port: 80\nhosts: a, b\nstart: 20230101\n")
+	assert.Nil(t, err)
+
+	c := kv.Clone()
+	assert.Equal(t, kv, c)
+
+	*c.Get("port").AsInt = 8080
+	c.Get("hosts").AsSliceS[0] = "z"
+	c.Get("start").AsDate = nil
+	c["new"] = Populate("1")
+
+	assert.Equal(t, 80, *kv.Get("port").AsInt)
+	assert.Equal(t, []string{"a", "b"}, kv.Get("hosts").AsSliceS)
+	assert.NotNil(t, kv.Get("start").AsDate)
+	assert.Nil(t, kv.Get("new"))
+	assert.Nil(t, KeyVal(nil).Clone())
+}
+
+func TestKeyVal_Keys(t *testing.T) {
+	kv, err := ReadKVString("zeta: 1\neqn: a=b\nalpha: 2\neqn: b=c\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"zeta", "eqn1", "alpha", "eqn2"}, kv.Keys())
+
+	kv["b"] = Populate("3")
+	kv["a"] = Populate("4")
+	kv.Get("zeta").AppendInt(5)
+	assert.Equal(t, []string{"zeta", "eqn1", "alpha", "eqn2", "a", "b"}, kv.Keys())
+
+	var keys []string
+	kv.Range(func(key string, val *Value) bool {
+		keys = append(keys, key)
+		return key != "alpha"
+	})
+	assert.Equal(t, []string{"zeta", "eqn1", "alpha"}, keys)
+}
+
+func TestReadKVOpts_NormalizeKey(t *testing.T) {
+	files := map[string]string{
+		"main.txt": "max-conns: 10\nsite_name : app\ninclude: more.txt\n",
+		"more.txt": "log-level: info\n",
+	}
+	resolver := func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(files[name])), nil
+	}
+
+	normalize := func(key string) string {
+		return strings.TrimPrefix(strings.ReplaceAll(StripSpaces(key), "-", "_"), "site_")
+	}
+
+	kv, err := ReadKVOpts("main.txt", Options{IncludeResolver: resolver, NormalizeKey: normalize})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"max_conns", "name", "log_level"}, keysOf(kv))
+
+	kv, err = ReadKVOpts("main.txt", Options{IncludeResolver: resolver})
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"max-conns", "site_name", "log-level"}, keysOf(kv))
+}
+
+func TestCheckLegals_MatchFull(t *testing.T) {
+	const legalDefs = `
+host:required-yes
+host:match-[a-z0-9.-]+
+host:matchfull-yes
+ids:required-no
+ids:match-[A-Z]{2}\d+
+ids:matchfull-yes`
+
+	kv, err := ReadKVString("host: db.example.com\nids: AB1, CD22\n")
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	// the whole value must match
+	kv["host"] = Populate("db.example.com/x")
+	assert.EqualError(t, CheckLegals(kv, legalDefs),
+		"value db.example.com/x for key host does not match pattern [a-z0-9.-]+")
+
+	kv["host"] = Populate("db")
+	kv["ids"] = Populate("AB1, C3, DE4")
+	assert.EqualError(t, CheckLegals(kv, legalDefs),
+		`element 2 (C3) of value for key ids does not match pattern [A-Z]{2}\d+`)
+
+	// without matchfull, a match anywhere in the whole value will do
+	assert.Nil(t, CheckLegals(kv, "host:required-yes\nhost:match-[a-z]+\nids:required-no\nids:match-[A-Z]{2}\\d+"))
+
+	// a bad expression is reported when the legals are built
+	_, _, _, err = BuildLegals("host:required-yes\nhost:match-([")
+	assert.EqualError(t, err, "bad pattern ([ for key host: error parsing regexp: missing closing ]: `[`")
+	assert.EqualError(t, CheckLegals(kv, "host:required-yes\nhost:match-(["),
+		"bad pattern ([ for key host: error parsing regexp: missing closing ]: `[`")
+
+	// pattern is match with matchfull
+	const patternDefs = "host:required-yes\nhost:pattern-[a-z0-9.-]+\nids:required-no\nids:pattern-[A-Z]{2}\\d+"
+	kv["host"] = Populate("db.example.com")
+	kv["ids"] = Populate("AB1, CD22")
+	assert.Nil(t, CheckLegals(kv, patternDefs))
+	kv["host"] = Populate("db.example.com/x")
+	assert.EqualError(t, CheckLegals(kv, patternDefs),
+		"value db.example.com/x for key host does not match pattern [a-z0-9.-]+")
+	kv["host"] = Populate("db")
+	kv["ids"] = Populate("AB1, C3")
+	err = CheckLegals(kv, patternDefs)
+	assert.EqualError(t, err, `element 2 (C3) of value for key ids does not match pattern [A-Z]{2}\d+`)
+	assert.True(t, errors.Is(err, ErrIllegalValue))
+
+	_, _, _, err = BuildLegals("host:pattern-([")
+	assert.EqualError(t, err, "bad pattern ([ for key host: error parsing regexp: missing closing ]: `[`")
+
+	// the cache of compiled expressions is bounded
+	for ind := 0; ind < 2*maxMatchRx; ind++ {
+		_, err = compileMatch(fmt.Sprintf("x%d", ind))
+		assert.Nil(t, err)
+	}
+	assert.LessOrEqual(t, len(matchRx.rx), maxMatchRx)
+
+	schema, err := NewSchema(KeySpec{Name: "ids", Match: `[A-Z]{2}\d+`, MatchFull: true})
+	assert.Nil(t, err)
+	assert.EqualError(t, schema.Check(KeyVal{"ids": Populate("AB1, C3")}),
+		`element 2 (C3) of value for key ids does not match pattern [A-Z]{2}\d+`)
+}
+
+func TestCheckLegals_DateRange(t *testing.T) {
+	const legalDefs = `
+start:required-yes
+start:type-date
+start:min-20230101
+start:max-2023-12-31
+end:required-no
+end:min-January 1, 2024`
+
+	kv, err := ProcessKVs([]string{"start", "end"}, []string{"2023-06-15", "2024-02-01"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["start"] = Populate("20221231")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value 20221231 for key start is before min 20230101")
+
+	kv["start"] = Populate("2024-01-01")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value 2024-01-01 for key start is after max 2023-12-31")
+
+	kv["start"] = Populate("2023-06-15")
+	kv["end"] = Populate("soon")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value soon for key end must be a date")
+}
+
+func TestCheckLegals_SliceType(t *testing.T) {
+	const legalDefs = `
+ports:required-yes
+ports:type-sliceint
+ports:minlen-2
+ports:maxlen-3
+waits:required-no
+waits:type-sliceduration`
+
+	kv, err := ReadKVString("ports: 80, 443\nwaits: 1s, 2m\n")
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["ports"] = Populate("80, https")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value to key ports must be a slice of int")
+
+	kv["ports"] = Populate("80")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "key ports has 1 elements, fewer than minlen 2")
+
+	kv["ports"] = Populate("80, 443")
+	kv["waits"] = Populate("1s, 2")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "value to key waits must be a slice of duration")
+
+	schema, err := NewSchema(KeySpec{Name: "ports", Type: "sliceint", MaxLen: 1})
+	assert.Nil(t, err)
+	assert.EqualError(t, schema.Check(kv), "key ports has 2 elements, more than maxlen 1")
+}
+
+func TestCheckLegals_Exclusive(t *testing.T) {
+	const legalDefs = `
+file:required-no
+url:required-no
+stdin:required-no
+verbose:required-no
+quiet:required-no
+quiet:conflicts-verbose,debug
+debug:required-no
+source:exclusive-file,url,stdin`
+
+	kv, err := ProcessKVs([]string{"file", "quiet"}, []string{"a.txt", "yes"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["url"] = Populate("http://host")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "at most one of [file url stdin] allowed, got 2")
+
+	delete(kv, "url")
+	kv["debug"] = Populate("yes")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "key quiet conflicts with key debug")
+
+	schema, err := NewSchema(KeySpec{Name: "file"}, KeySpec{Name: "url"}, KeySpec{Name: "quiet", Conflicts: []string{"debug"}},
+		KeySpec{Name: "debug"})
+	assert.Nil(t, err)
+	schema.Exclusive("source", "file", "url")
+	assert.EqualError(t, schema.Check(kv), "key quiet conflicts with key debug")
+
+	delete(kv, "debug")
+	kv["url"] = Populate("http://host")
+	assert.EqualError(t, schema.Check(kv), "at most one of [file url] allowed, got 2")
+}
+
+func TestCheckLegals_RequiredIf(t *testing.T) {
+	const legalDefs = `
+tls:required-no
+cert:required-no
+cert:requiredif-tls=yes
+mode:required-no
+workers:required-no
+workers:requiredif-mode=2
+replica:required-no
+primary:required-no
+primary:requiredif-replica`
+
+	kv, err := ProcessKVs([]string{"tls", "mode"}, []string{"no", "1"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, legalDefs))
+
+	kv["tls"] = Populate(" yes")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "missing key cert, required when tls is yes")
+
+	kv["cert"] = Populate("server.pem")
+	kv["mode"] = Populate("2.0")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "missing key workers, required when mode is 2")
+
+	kv["workers"] = Populate("4")
+	kv["replica"] = Populate("db2")
+	assert.EqualError(t, CheckLegals(kv, legalDefs), "missing key primary, required when replica is present")
+
+	// any occurrence of a duplicated key may make another key required
+	multiDefs := legalDefs + "\nmode:multiple-yes"
+	kv, err = ProcessKVs([]string{"mode", "mode"}, []string{"1", "3"})
+	assert.Nil(t, err)
+	assert.Nil(t, CheckLegals(kv, multiDefs))
+
+	kv, err = ProcessKVs([]string{"mode", "mode"}, []string{"1", "2"})
+	assert.Nil(t, err)
+	assert.EqualError(t, CheckLegals(kv, multiDefs), "missing key workers, required when mode is 2")
+
+	schema, err := NewSchema(KeySpec{Name: "tls"}, KeySpec{Name: "cert", RequiredIf: "tls=yes"})
+	assert.Nil(t, err)
+	kv, err = ProcessKVs([]string{"tls"}, []string{"yes"})
+	assert.Nil(t, err)
+	assert.EqualError(t, schema.Check(kv), "missing key cert, required when tls is yes")
+}
+
+func TestReadKVFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"conf/main.txt":    {Data: []byte("host: localhost\ninclude: conf/db.txt\ninclude: extra/*.txt\n")},
+		"conf/none.txt":    {Data: []byte("include: extra/*.kv\n")},
+		"conf/db.txt":      {Data: []byte("port: 5432\n")},
+		"conf/extra/a.txt": {Data: []byte("a: 1\n")},
+		"conf/extra/b.txt": {Data: []byte("b: 2\n")},
+	}
+
+	kv, err := ReadKVFS(fsys, "conf/main.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"host", "port", "a", "b"}, kv.Keys())
+	assert.Equal(t, 5432, *kv.Get("port").AsInt)
+
+	_, err = ReadKVFS(fsys, "conf/missing.txt")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	// a glob include is relative to the directory of the file with the include
+	_, err = ReadKVFS(fsys, "conf/none.txt")
+	assert.EqualError(t, err, "include conf/extra/*.kv in file conf/none.txt matches no files")
+}
+
+func TestReadKVOpts_LazyPopulate(t *testing.T) {
+	ListDelim = "|"
+	defer func() { ListDelim = "," }()
+	files := map[string]string{"main.txt": "port: 80\nhosts: a, b\nstart: 2023-01-15\nname: \"x, y\"\n"}
+	resolver := func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(files[name])), nil
+	}
+
+	kv, err := ReadKVOpts("main.txt", Options{IncludeResolver: resolver, LazyPopulate: true, ListDelim: ","})
+	assert.Nil(t, err)
+
+	// nothing is converted until used
+	assert.Nil(t, kv["port"].AsInt)
+	assert.Equal(t, String, kv["port"].BestType)
+	assert.Equal(t, "x, y", kv["name"].AsString)
+
+	assert.Equal(t, 80, *kv.Get("port").AsInt)
+	assert.Equal(t, 80, *kv["port"].AsInt)
+	assert.Equal(t, Int, kv["port"].BestType)
+
+	// the list delimiter of the Options is kept for later
+	assert.Equal(t, []string{"a", "b"}, kv["hosts"].Resolve().AsSliceS)
+	assert.Equal(t, "2023-01-15", kv["start"].String())
+	assert.Equal(t, []string{"port", "hosts", "start", "name"}, kv.Keys())
+
+	assert.Nil(t, CheckLegals(kv, "port:required-yes\nport:type-int\nhosts:required-yes\nhosts:type-slicestr\n"+
+		"start:required-yes\nstart:type-date\nname:required-yes"))
+}
+
+func TestDataType_Values(t *testing.T) {
+	// the values of the original types must not change
+	assert.Equal(t, DataType(7), SliceDate)
+	assert.Equal(t, DataType(8), InValid)
+	assert.Equal(t, DataType(9), Bool)
+	assert.Equal(t, "InValid", InValid.String())
+	assert.Equal(t, "Decimal", Decimal.String())
+}
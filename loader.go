@@ -0,0 +1,107 @@
+package keyval
+
+import (
+	"context"
+	"flag"
+)
+
+// Loader builds a KeyVal from layered sources.  In increasing order of precedence they are the defaults of
+// the Schema, the files in the order added, the environment and the flags.  The result is checked against
+// the Schema.
+type Loader struct {
+	schema    *Schema
+	opts      Options
+	files     []string
+	envPrefix *string
+	flags     *flag.FlagSet
+}
+
+// Source names for the provenance returned by Load.  Keys read from files have the name of the file.
+const (
+	SourceDefault = "default"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// NewLoader returns a Loader that reads files with opts and checks the result against schema.  schema may
+// be nil, in which case there are no defaults and no checks.
+func NewLoader(schema *Schema, opts Options) *Loader {
+	return &Loader{schema: schema, opts: opts}
+}
+
+// File adds a keyval file.  Keys in later files take precedence over earlier ones.
+func (l *Loader) File(name string) *Loader {
+	l.files = append(l.files, name)
+	return l
+}
+
+// Env sets keys from the environment variables with prefix, using the Options of the Loader.  prefix must
+// not be empty.  See ApplyEnv.
+func (l *Loader) Env(prefix string) *Loader {
+	l.envPrefix = &prefix
+	return l
+}
+
+// Flags sets keys from the flags of fs that were set on the command line.  fs must be parsed before Load.
+// See ApplyFlags.
+func (l *Loader) Flags(fs *flag.FlagSet) *Loader {
+	l.flags = fs
+	return l
+}
+
+// Load reads the sources and returns the KeyVal along with the source of each key: SourceDefault, the name
+// of a file, SourceEnv or SourceFlag.
+func (l *Loader) Load() (kv KeyVal, sources map[string]string, err error) {
+	return l.LoadContext(context.Background())
+}
+
+// LoadContext is Load that stops reading files when ctx is done.  See ReadKVContext.
+func (l *Loader) LoadContext(ctx context.Context) (kv KeyVal, sources map[string]string, err error) {
+	kv, sources = make(KeyVal), make(map[string]string)
+	if l.schema != nil {
+		l.schema.ApplyDefaults(kv)
+		for key := range kv {
+			sources[key] = SourceDefault
+		}
+	}
+
+	for _, file := range l.files {
+		fileKV, e := ReadKVOptsContext(ctx, file, l.opts)
+		if e != nil {
+			return nil, nil, e
+		}
+
+		kv = kv.Merge(fileKV, MergeOverwrite)
+		for key := range fileKV {
+			sources[key] = file
+		}
+	}
+
+	if l.envPrefix != nil {
+		for _, key := range kv.ApplyEnvOpts(*l.envPrefix, l.opts) {
+			sources[key] = SourceEnv
+		}
+	}
+
+	if l.flags != nil {
+		kv.ApplyFlags(l.flags)
+		l.flags.Visit(func(f *flag.Flag) {
+			sources[kv.foldKey(f.Name)] = SourceFlag
+		})
+	}
+
+	// drop the sources of keys that a later source replaced under another name
+	for key := range sources {
+		if _, ok := kv[key]; !ok {
+			delete(sources, key)
+		}
+	}
+
+	if l.schema != nil {
+		if e := l.schema.Check(kv); e != nil {
+			return nil, nil, e
+		}
+	}
+
+	return kv, sources, nil
+}
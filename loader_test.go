@@ -0,0 +1,54 @@
+package keyval
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoader(t *testing.T) {
+	dir := t.TempDir()
+	base, local := filepath.Join(dir, "base.txt"), filepath.Join(dir, "local.txt")
+	assert.Nil(t, os.WriteFile(base, []byte("host: base.example.com\nport: 80\nname: app\n"), 0644))
+	assert.Nil(t, os.WriteFile(local, []byte("port: 8080\n"), 0644))
+
+	schema, err := NewSchema(
+		KeySpec{Name: "host", Required: true},
+		KeySpec{Name: "port", Type: "int"},
+		KeySpec{Name: "name"},
+		KeySpec{Name: "timeout", Type: "duration", Default: "30s"},
+		KeySpec{Name: "debug", Type: "bool", Default: "no"},
+		KeySpec{Name: "log-level", Values: []string{"info", "debug"}, Default: "info"},
+	)
+	assert.Nil(t, err)
+
+	t.Setenv("LOADTEST_LOG_LEVEL", "debug")
+	t.Setenv("LOADTEST_NAME", "env-app")
+	t.Setenv("LOADTEST_CACHE_SIZE", "64")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("name", "", "name")
+	fs.Bool("debug", false, "debug")
+	assert.Nil(t, fs.Parse([]string{"-debug"}))
+
+	kv, sources, err := NewLoader(schema, Options{}).File(base).File(local).Env("loadtest").Flags(fs).Load()
+	assert.Nil(t, err)
+
+	assert.Equal(t, "base.example.com", kv.GetTrim("host"))
+	assert.Equal(t, 8080, kv.GetInt("port", 0))
+	assert.Equal(t, "env-app", kv.GetTrim("name"))
+	assert.Equal(t, "debug", kv.GetTrim("log-level"))
+	assert.True(t, kv.GetBool("debug", false))
+	assert.Equal(t, map[string]string{"host": base, "port": local, "name": SourceEnv, "log-level": SourceEnv,
+		"debug": SourceFlag, "timeout": SourceDefault}, sources)
+
+	// the result is checked against the schema
+	_, _, err = NewLoader(schema, Options{}).File(local).Load()
+	assert.EqualError(t, err, "missing required key host")
+
+	_, _, err = NewLoader(nil, Options{}).File(filepath.Join(dir, "missing.txt")).Load()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,175 @@
+package keyval
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Parser reads keyvals and validates them against a fixed set of legals.  The legals are built once, when
+// the Parser is created.
+//
+// A Parser carries its own Options, including delimiters, date formats and the duplicate key policy, so
+// Parsers with different settings may be used concurrently.  The Parser methods that read, write, edit and
+// document keyvals use only its Options.  The package-level functions behave as a Parser with the zero
+// Options, which uses the package variables KVDelim, ListDelim and LineEOL.
+type Parser struct {
+	opts Options
+
+	// the legals as returned by BuildLegals
+	kl, fl, vl []string
+}
+
+// Option sets part of the Options of a Parser.  See NewParser.
+type Option func(opts *Options)
+
+// WithOptions sets all the Options.  Options that follow it change these.
+func WithOptions(o Options) Option {
+	return func(opts *Options) { *opts = o }
+}
+
+// WithKVDelim sets the delimiter between a key and its value.
+func WithKVDelim(delim string) Option {
+	return func(opts *Options) { opts.KVDelim = delim }
+}
+
+// WithListDelim sets the delimiter between the elements of a list.
+func WithListDelim(delim string) Option {
+	return func(opts *Options) { opts.ListDelim = delim }
+}
+
+// WithLineEOL sets the end of line.
+func WithLineEOL(eol string) Option {
+	return func(opts *Options) { opts.LineEOL = eol }
+}
+
+// WithDateFormats adds layouts tried, after the built-in ones, when converting a value to a date.
+func WithDateFormats(layouts ...string) Option {
+	return func(opts *Options) { opts.DateFormats = append(opts.DateFormats, layouts...) }
+}
+
+// WithDuplicates sets how duplicate keys are handled.
+func WithDuplicates(policy DuplicatePolicy) Option {
+	return func(opts *Options) { opts.Duplicates = policy }
+}
+
+// NewParser returns a Parser that reads keyvals with the Options set by opts, in order, and checks them against
+// legals.  See CheckLegals for the format of legals.  An error is returned if legals is malformed.
+func NewParser(legals string, opts ...Option) (*Parser, error) {
+	kl, fl, vl, e := BuildLegals(legals)
+	if e != nil {
+		return nil, e
+	}
+
+	p := &Parser{kl: kl, fl: fl, vl: vl}
+	for _, opt := range opts {
+		opt(&p.opts)
+	}
+
+	return p, nil
+}
+
+// Options returns the Options of p.
+func (p *Parser) Options() Options {
+	return p.opts
+}
+
+// ReadKV2Slc reads specFile and returns the key/vals as two slices of strings.  See ReadKV2Slc.
+func (p *Parser) ReadKV2Slc(specFile string) (keys, vals []string, err error) {
+	return ReadKV2SlcOpts(specFile, p.opts)
+}
+
+// ProcessKVs processes keys and vals into a KeyVal without checking the legals.  See ProcessKVs.
+func (p *Parser) ProcessKVs(keys, vals []string) (KeyVal, error) {
+	return ProcessKVsOpts(keys, vals, p.opts)
+}
+
+// Populate populates a Value from valStr.  See Populate.
+func (p *Parser) Populate(valStr string) *Value {
+	return populate(valStr, p.opts)
+}
+
+// ParseFile reads the keyvals in specFile and checks them against the legals.  Aliases and deprecated keys with
+// a replacement are renamed and missing keys that have a default in the legals are added first.  See
+// ApplyAliases and ApplyDefaults.  Warnings are passed to the Warn function of the Options.
+func (p *Parser) ParseFile(specFile string) (KeyVal, error) {
+	keys, vals, comments, e := readKV2SlcFile(specFile, p.opts, nil)
+	if e != nil {
+		return nil, e
+	}
+
+	return p.process(keys, vals, comments)
+}
+
+// ParseFileContext is ParseFile that stops when ctx is done.  See ReadKVContext.
+func (p *Parser) ParseFileContext(ctx context.Context, specFile string) (KeyVal, error) {
+	opts := p.opts
+	opts.ctx = ctx
+
+	keys, vals, comments, e := readKV2SlcFile(specFile, opts, nil)
+	if e != nil {
+		return nil, e
+	}
+
+	return p.process(keys, vals, comments)
+}
+
+// ParseString reads the keyvals in content and checks them against the legals.  Aliases and defaults are
+// applied as in ParseFile.
+func (p *Parser) ParseString(content string) (KeyVal, error) {
+	keys, vals, comments, e := readKV2Slc(strings.NewReader(content), "<string>", p.opts, nil)
+	if e != nil {
+		return nil, e
+	}
+
+	return p.process(keys, vals, comments)
+}
+
+// Write writes kv to w using the delimiters of p.  See KeyVal.Write.
+func (p *Parser) Write(w io.Writer, kv KeyVal) error {
+	return kv.WriteOpts(w, p.opts)
+}
+
+// WriteFile writes kv to the file fileName using the delimiters of p.  See KeyVal.WriteFile.
+func (p *Parser) WriteFile(fileName string, kv KeyVal) error {
+	return kv.WriteFileOpts(fileName, p.opts)
+}
+
+// EditValue replaces the value of key in file with newValue.  See EditValueOpts.
+func (p *Parser) EditValue(file, key, newValue string) error {
+	return EditValueOpts(file, key, newValue, p.opts)
+}
+
+// Template returns a keyval file documenting the legals of p.  See Template.
+func (p *Parser) Template() string {
+	return template(p.kl, p.fl, p.vl, p.opts)
+}
+
+// process builds the KeyVal from keys, vals and comments, applies the aliases and defaults of the legals and
+// checks it.
+func (p *Parser) process(keys, vals, comments []string) (KeyVal, error) {
+	kv, e := processKVs(keys, vals, comments, p.opts)
+	if e != nil {
+		return nil, e
+	}
+
+	renamed, e := applyAliases(kv, p.kl, p.fl, p.vl)
+	if e != nil {
+		return nil, e
+	}
+
+	applyDefaults(kv, p.kl, p.fl, p.vl, p.opts)
+
+	errs, warnings := checkLegals(kv, p.kl, p.fl, p.vl, p.opts.Validators, false)
+	if p.opts.Warn != nil {
+		for _, warning := range append(append(renamed, deprecations(kv, p.kl, p.fl, p.vl)...), warnings...) {
+			p.opts.Warn(warning)
+		}
+	}
+
+	if errs != nil {
+		return nil, errs[0]
+	}
+
+	return kv, nil
+}
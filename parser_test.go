@@ -0,0 +1,166 @@
+package keyval
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParser(t *testing.T) {
+	const legals = `
+host:required-yes
+port:required-yes
+port:type-int
+port:max-65535`
+
+	_, err := NewParser("host:requried-yes")
+	assert.EqualError(t, err, `unknown legal field "requried" for key host`)
+
+	opts := Options{Validators: map[string]func(*Value) error{
+		"port": func(v *Value) error {
+			if *v.AsInt < 1024 {
+				return fmt.Errorf("port %d is reserved", *v.AsInt)
+			}
+			return nil
+		},
+	}}
+
+	p, err := NewParser(legals, WithOptions(opts))
+	assert.Nil(t, err)
+
+	kv, err := p.ParseString("host: localhost\nport: 8080\n")
+	assert.Nil(t, err)
+	assert.Equal(t, 8080, *kv.Get("port").AsInt)
+
+	_, err = p.ParseString("host: localhost\nport: 80\n")
+	assert.EqualError(t, err, "port 80 is reserved")
+
+	_, err = p.ParseString("host: localhost\nport: 99999\n")
+	assert.EqualError(t, err, "value 99999 for key port exceeds max 65535")
+
+	fileName := filepath.Join(t.TempDir(), "spec.txt")
+	assert.Nil(t, os.WriteFile(fileName, []byte("port: 8080\n"), 0644))
+	_, err = p.ParseFile(fileName)
+	assert.EqualError(t, err, "missing required key host")
+}
+
+func TestParser_Options(t *testing.T) {
+	semi, err := NewParser("", WithKVDelim("="), WithListDelim(";"), WithDateFormats("02.01.2006"))
+	assert.Nil(t, err)
+
+	kv, err := semi.ParseString("hosts = a:1; b:2\nstart = 15.10.2023\n")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a:1", "b:2"}, kv.Get("hosts").AsSliceS)
+	assert.Equal(t, Date, kv.Get("start").BestType)
+	assert.Equal(t, SliceInt, semi.Populate("1;2").BestType)
+
+	// the package variables are not affected
+	assert.Equal(t, String, Populate("15.10.2023").BestType)
+	assert.Equal(t, SliceStr, Populate("1;2,3").BestType)
+
+	keys, vals := []string{"a", "a", "b"}, []string{"1", "2", "3"}
+	for policy, exp := range map[DuplicatePolicy][]string{DupFirst: {"1", "3"}, DupLast: {"2", "3"}} {
+		p, err := NewParser("", WithDuplicates(policy))
+		assert.Nil(t, err)
+
+		kv, err := p.ProcessKVs(keys, vals)
+		assert.Nil(t, err)
+		assert.ElementsMatch(t, []string{"a", "b"}, keysOf(kv))
+		assert.Equal(t, exp, []string{kv.GetTrim("a"), kv.GetTrim("b")})
+	}
+
+	p, err := NewParser("", WithDuplicates(DupError))
+	assert.Nil(t, err)
+	_, err = p.ProcessKVs(keys, vals)
+	assert.EqualError(t, err, "duplicate key a")
+}
+
+func TestParser_Defaults(t *testing.T) {
+	const legals = `
+host:required-yes
+port:required-no
+port:type-int
+port:default-5432
+timeout:required-no
+timeout:default-30s`
+
+	p, err := NewParser(legals)
+	assert.Nil(t, err)
+
+	kv, err := p.ParseString("host: localhost\ntimeout: 1m\n")
+	assert.Nil(t, err)
+	assert.Equal(t, 5432, *kv.Get("port").AsInt)
+	assert.Equal(t, "1m0s", kv.Get("timeout").String())
+
+	schema, err := NewSchema(KeySpec{Name: "port", Type: "int", Default: "5432"})
+	assert.Nil(t, err)
+	kv = KeyVal{}
+	schema.ApplyDefaults(kv)
+	assert.Equal(t, 5432, *kv.Get("port").AsInt)
+}
+
+func TestParser_Deprecated(t *testing.T) {
+	const legals = `
+host:required-yes
+server:deprecated-host
+port:required-no
+port:type-int
+port:severity-warn
+verbose:deprecated-yes`
+
+	var warnings []string
+	p, err := NewParser(legals, WithOptions(Options{Warn: func(w string) { warnings = append(warnings, w) }}))
+	assert.Nil(t, err)
+
+	kv, err := p.ParseString("server: localhost\nport: http\nverbose: yes\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost", kv.GetTrim("host"))
+	assert.Nil(t, kv.Get("server"))
+	assert.Equal(t, []string{"key server is deprecated: use host", "key verbose is deprecated",
+		"value to key port must be integer"}, warnings)
+
+	_, err = p.ParseString("server: localhost\nhost: localhost\n")
+	assert.EqualError(t, err, "key server and its replacement host are both present")
+
+	// a deprecated key that is not renamed still gets its warning
+	kv, err = ReadKVString("server: localhost\n")
+	assert.Nil(t, err)
+	warns, err := CheckLegalsWarn(kv, legals)
+	assert.Equal(t, []string{"key server is deprecated: use host"}, warns)
+	assert.EqualError(t, err, "missing required key host")
+
+	schema, err := NewSchema(KeySpec{Name: "host", Required: true}, KeySpec{Name: "server", Deprecated: "host"})
+	assert.Nil(t, err)
+	warns, err = schema.ApplyAliases(kv)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"key server is deprecated: use host"}, warns)
+	assert.Nil(t, schema.Check(kv))
+}
+
+func TestParser_WriteEditTemplate(t *testing.T) {
+	p, err := NewParser("host:required-yes\nhost:doc-the host\nports:required-no",
+		WithOptions(Options{CommentPrefix: "#"}), WithKVDelim("="), WithListDelim(";"), WithLineEOL("\r"))
+	assert.Nil(t, err)
+	assert.Equal(t, "=", p.Options().KVDelim)
+	assert.Equal(t, "#", p.Options().CommentPrefix)
+
+	kv, err := p.ParseString("# the host\rhost = localhost\rports = 80; 443\r")
+	assert.Nil(t, err)
+
+	fileName := filepath.Join(t.TempDir(), "spec.txt")
+	assert.Nil(t, p.WriteFile(fileName, kv))
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, "# the host\rhost= localhost\rports= 80; 443\r", string(content))
+
+	assert.Nil(t, p.EditValue(fileName, "ports", "8080; 8443"))
+	kv, err = p.ParseFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{8080, 8443}, kv.Get("ports").AsSliceI)
+
+	assert.Equal(t, "# the host\r# type: string, required: yes\rhost=\r\r# type: string, required: no\r# ports=\r",
+		p.Template())
+}
@@ -0,0 +1,103 @@
+package keyval
+
+import "sync"
+
+// SafeKeyVal wraps a KeyVal so it can be read and modified by concurrent goroutines.
+//
+// A plain KeyVal is safe for concurrent reads once it is built, but not if any goroutine modifies it.
+// The Values returned by SafeKeyVal are shared and must not be modified; use Set to replace a Value.  A reload,
+// such as the callback of a Watcher, installs a new KeyVal with Swap.
+type SafeKeyVal struct {
+	mu sync.RWMutex
+	kv KeyVal
+}
+
+// NewSafeKeyVal returns a SafeKeyVal holding kv.  kv should not be used directly afterwards.
+func NewSafeKeyVal(kv KeyVal) *SafeKeyVal {
+	if kv == nil {
+		kv = make(KeyVal)
+	}
+
+	return &SafeKeyVal{kv: kv}
+}
+
+// Get returns the Value of key.  See KeyVal.Get.
+func (s *SafeKeyVal) Get(key string) *Value {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.kv.Get(key)
+}
+
+// GetBest returns the Value element of the BestType of key along with what that type is.  See KeyVal.GetBest.
+func (s *SafeKeyVal) GetBest(key string) (data any, datatype DataType) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.kv.GetBest(key)
+}
+
+// GetMultiple returns the Values of the duplicate keys of root.  See KeyVal.GetMultiple.
+func (s *SafeKeyVal) GetMultiple(root string) []*Value {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.kv.GetMultiple(root)
+}
+
+// Set sets the Value of key.
+func (s *SafeKeyVal) Set(key string, val *Value) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.kv[key] = val
+}
+
+// Delete removes key.
+func (s *SafeKeyVal) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.kv, key)
+}
+
+// Swap replaces the KeyVal held by s with kv and returns the old one.  Use it to install a reloaded config.
+// kv should not be used directly afterwards.
+func (s *SafeKeyVal) Swap(kv KeyVal) KeyVal {
+	if kv == nil {
+		kv = make(KeyVal)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.kv
+	s.kv = kv
+
+	return old
+}
+
+// Update calls f with the KeyVal held by s while no other goroutine can use it, so several changes can be
+// made together.  f must not keep kv or call the methods of s.
+func (s *SafeKeyVal) Update(f func(kv KeyVal)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f(s.kv)
+}
+
+// Snapshot returns a copy of the KeyVal held by s.  See KeyVal.Clone.
+func (s *SafeKeyVal) Snapshot() KeyVal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.kv.Clone()
+}
+
+// Keys returns the keys of s.  See KeyVal.Keys.
+func (s *SafeKeyVal) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.kv.Keys()
+}
@@ -0,0 +1,105 @@
+package keyval
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeKeyVal(t *testing.T) {
+	kv, err := ProcessKVs([]string{"a", "eqn", "eqn"}, []string{"1", "x", "y"})
+	assert.Nil(t, err)
+
+	safe := NewSafeKeyVal(kv)
+
+	var wg sync.WaitGroup
+	for ind := 0; ind < 10; ind++ {
+		wg.Add(2)
+		go func(ind int) {
+			defer wg.Done()
+			safe.Set(fmt.Sprintf("k%d", ind), Populate(fmt.Sprint(ind)))
+		}(ind)
+
+		go func() {
+			defer wg.Done()
+			_ = safe.Get("a")
+			_, _ = safe.GetBest("a")
+			_ = safe.GetMultiple("eqn")
+		}()
+	}
+	wg.Wait()
+
+	for ind := 0; ind < 10; ind++ {
+		data, dt := safe.GetBest(fmt.Sprintf("k%d", ind))
+		assert.Equal(t, Int, dt)
+		assert.Equal(t, ind, *data.(*int))
+	}
+
+	assert.Len(t, safe.GetMultiple("eqn"), 2)
+
+	safe.Delete("a")
+	assert.Nil(t, safe.Get("a"))
+}
+
+func TestSafeKeyVal_Lazy(t *testing.T) {
+	kv, err := ProcessKVsOpts([]string{"a", "hosts", "eqn", "eqn"}, []string{"1", "x, y", "2", "3"},
+		Options{LazyPopulate: true})
+	assert.Nil(t, err)
+
+	// the Values are resolved by the first reader only
+	safe := NewSafeKeyVal(kv)
+	var wg sync.WaitGroup
+	for ind := 0; ind < 10; ind++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, 1, *safe.Get("a").AsInt)
+			assert.Equal(t, "[x y]", safe.Get("hosts").String())
+			assert.Len(t, safe.GetMultiple("eqn"), 2)
+			_, dt := safe.GetBest("eqn1")
+			assert.Equal(t, Int, dt)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSafeKeyVal_Swap(t *testing.T) {
+	kv, err := ReadKVString("port: 80\nhost: localhost\n")
+	assert.Nil(t, err)
+
+	safe := NewSafeKeyVal(kv)
+	snap := safe.Snapshot()
+
+	var wg sync.WaitGroup
+	for ind := 0; ind < 10; ind++ {
+		wg.Add(2)
+		go func(ind int) {
+			defer wg.Done()
+			next, _ := ReadKVString(fmt.Sprintf("port: %d\nhost: localhost\n", 8000+ind))
+			safe.Swap(next)
+		}(ind)
+
+		go func() {
+			defer wg.Done()
+			assert.NotNil(t, safe.Get("port"))
+			assert.Equal(t, []string{"port", "host"}, safe.Keys())
+		}()
+	}
+	wg.Wait()
+
+	assert.GreaterOrEqual(t, *safe.Get("port").AsInt, 8000)
+	assert.Equal(t, 80, *snap.Get("port").AsInt)
+
+	safe.Update(func(kv KeyVal) {
+		kv["port"] = Populate("9090")
+		delete(kv, "host")
+	})
+	assert.Equal(t, 9090, *safe.Get("port").AsInt)
+	assert.Nil(t, safe.Get("host"))
+
+	old := safe.Swap(nil)
+	assert.Equal(t, 9090, *old.Get("port").AsInt)
+	assert.Empty(t, safe.Keys())
+}
@@ -0,0 +1,50 @@
+package keyval
+
+import (
+	"io"
+	"strings"
+)
+
+// Scanner reads the key/vals of a keyval file one at a time without building a KeyVal, so a large file can be
+// filtered or counted in constant memory.
+//
+// Each value is converted by Populate.  Since there is no KeyVal, includes are not followed, duplicate keys are
+// not numbered and ResolveRefs and ExpandEnv have no effect: include and include-if are returned like any other
+// key.
+type Scanner struct {
+	er   *entryReader
+	opts Options
+}
+
+// NewScanner returns a Scanner that reads r using opts.
+func NewScanner(r io.Reader, opts Options) *Scanner {
+	return &Scanner{er: newEntryReader(r, "<reader>", opts), opts: opts}
+}
+
+// Next returns the next key, its Value and the line on which it starts.  At the end of the file, err is io.EOF.
+func (s *Scanner) Next() (key string, val *Value, line int, err error) {
+	entry, line, comment, e := s.er.next()
+	if e != nil {
+		return "", nil, 0, e
+	}
+
+	// the last entry is empty if the file ends with comments
+	if strings.Trim(entry, " ") == "" {
+		return "", nil, 0, io.EOF
+	}
+
+	kvSlice := strings.SplitN(entry, s.opts.kvDelim(), 2)
+	if len(kvSlice) != 2 {
+		return "", nil, 0, &ParseError{File: s.er.specFile, Line: line, Text: strings.Trim(entry, " ")}
+	}
+
+	key = s.opts.normalizeKey(kvSlice[0])
+	if s.opts.CaseInsensitiveKeys {
+		key = strings.ToLower(key)
+	}
+
+	val = populate(strings.TrimLeft(kvSlice[1], " "), s.opts)
+	val.Comment, val.seq, val.folded = comment, line, s.opts.CaseInsensitiveKeys
+
+	return key, val, line, nil
+}
@@ -0,0 +1,66 @@
+package keyval
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanner(t *testing.T) {
+	const content = `// the host
+host: localhost
+port: 80 // default
+hosts: a, b,
+  cd
+motd: <<END
+hello
+END
+eqn: a=b
+eqn: b=c
+// trailing comment
+`
+	s := NewScanner(strings.NewReader(content), Options{})
+
+	var keys []string
+	var lines []int
+	for {
+		key, val, line, err := s.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		assert.Nil(t, err)
+		keys, lines = append(keys, key), append(lines, line)
+
+		switch key {
+		case "host":
+			assert.Equal(t, "the host", val.Comment)
+		case "port":
+			assert.Equal(t, 80, *val.AsInt)
+			assert.Equal(t, "default", val.Comment)
+		case "hosts":
+			assert.Equal(t, []string{"a", "b", "cd"}, val.AsSliceS)
+		case "motd":
+			assert.Equal(t, "hello", val.AsString)
+		}
+	}
+
+	assert.Equal(t, []string{"host", "port", "hosts", "motd", "eqn", "eqn"}, keys)
+	assert.Equal(t, []int{2, 3, 4, 6, 9, 10}, lines)
+
+	_, _, _, err := s.Next()
+	assert.Equal(t, io.EOF, err)
+
+	s = NewScanner(strings.NewReader("// header\nno delimiter here\n"), Options{})
+	_, _, _, err = s.Next()
+	assert.EqualError(t, err, "bad key val: no delimiter here in file <reader>, line 2")
+
+	s = NewScanner(strings.NewReader("Port= 80\n"), Options{KVDelim: "=", CaseInsensitiveKeys: true})
+	key, val, _, err := s.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "port", key)
+	assert.Equal(t, 80, *val.AsInt)
+}
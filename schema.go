@@ -0,0 +1,244 @@
+package keyval
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeySpec describes a key of a Schema.  The fields correspond to the fields of the legals described under
+// BuildLegals.
+type KeySpec struct {
+	Name       string
+	Required   bool
+	Type       string   // Type is string, int, float, decimal, date, bool, duration, bytes, percent, sliceint, etc.
+	Values     []string // Values, if not empty, are the legal values of the key
+	Requires   string   // Requires is another key that must be present if this key is
+	RequiredIf string   // RequiredIf makes the key required if another key has a value: "key=value" or just "key"
+	Conflicts  []string // Conflicts are keys that may not be present with this key
+	Match      string   // Match, if not empty, is a regular expression the value must match
+	MatchFull  bool     // MatchFull makes Match apply to each element of the value in full
+	Min        string   // Min, if not empty, is the smallest legal number, byte size or percent or earliest legal date
+	Max        string   // Max, if not empty, is the largest legal number, byte size or percent or latest legal date
+	MinLen     int      // MinLen, if positive, is the fewest elements the value may have
+	MaxLen     int      // MaxLen, if positive, is the most elements the value may have
+	Multiple   bool     // Multiple allows the key to be duplicated
+	Default    string   // Default is the value ApplyDefaults uses if the key is missing
+	Warn       bool     // Warn makes violations of the key warnings rather than errors
+	Deprecated string   // Deprecated, if not empty, is "yes", a message or the name of the key that replaces this one
+}
+
+// Schema is a set of legals built in Go code rather than from the string format of BuildLegals.
+type Schema struct {
+	specs      []KeySpec
+	kl, fl, vl []string
+	validators map[string][]func(key string, v *Value) error
+}
+
+// legalTypes are the values of the type field of the legals.
+var legalTypes = []string{"string", "int", "float", "decimal", "date", "bool", "duration", "bytes", "percent",
+	"slicestr", "sliceint", "slicefloat", "slicedate", "slicebool", "sliceduration", "slicepercent"}
+
+// NewSchema returns a Schema with the keys in specs.  An error is returned if a KeySpec is malformed:
+// the Name is empty, repeated or has the key/value delimiter of the legals, the Type is unknown, a value has
+// a comma or the Default is not legal.
+func NewSchema(specs ...KeySpec) (*Schema, error) {
+	s := &Schema{}
+	for _, spec := range specs {
+		if spec.Name == "" || strings.ContainsAny(spec.Name, ": \t\n") {
+			return nil, fmt.Errorf("bad key name %q in schema", spec.Name)
+		}
+
+		if searchSlice(spec.Name, s.kl) >= 0 {
+			return nil, fmt.Errorf("key %s is in schema more than once", spec.Name)
+		}
+
+		if spec.Type != "" && searchSlice(spec.Type, legalTypes) < 0 {
+			return nil, fmt.Errorf("unknown type %s for key %s in schema", spec.Type, spec.Name)
+		}
+
+		for _, v := range spec.Values {
+			if strings.Contains(v, ",") {
+				return nil, fmt.Errorf("value %q for key %s in schema has a comma", v, spec.Name)
+			}
+		}
+
+		s.add(spec.Name, "required", yesNo(spec.Required))
+		if spec.Type != "" {
+			s.add(spec.Name, "type", spec.Type)
+		}
+
+		if spec.Multiple {
+			s.add(spec.Name, "multiple", "yes")
+		}
+
+		if spec.Values != nil {
+			s.add(spec.Name, "values", strings.Join(spec.Values, ","))
+		}
+
+		if spec.Requires != "" {
+			s.add(spec.Name, "requires", spec.Requires)
+		}
+
+		if spec.RequiredIf != "" {
+			s.add(spec.Name, "requiredif", spec.RequiredIf)
+		}
+
+		if spec.Conflicts != nil {
+			s.add(spec.Name, "conflicts", strings.Join(spec.Conflicts, ","))
+		}
+
+		if spec.Match != "" {
+			if _, e := compileMatch(spec.Match); e != nil {
+				return nil, fmt.Errorf("bad pattern for key %s in schema: %v", spec.Name, e)
+			}
+
+			s.add(spec.Name, "match", spec.Match)
+			if spec.MatchFull {
+				s.add(spec.Name, "matchfull", "yes")
+			}
+		}
+
+		for _, bound := range []struct{ field, lim string }{{"min", spec.Min}, {"max", spec.Max}} {
+			if bound.lim == "" {
+				continue
+			}
+
+			if _, e := strconv.ParseFloat(bound.lim, 64); e != nil && toDate(bound.lim) == nil &&
+				toBytes(bound.lim) == nil && toPercent(bound.lim) == nil {
+				return nil, fmt.Errorf("bad %s %s for key %s in schema", bound.field, bound.lim, spec.Name)
+			}
+
+			s.add(spec.Name, bound.field, bound.lim)
+		}
+
+		if spec.MinLen > 0 {
+			s.add(spec.Name, "minlen", strconv.Itoa(spec.MinLen))
+		}
+
+		if spec.MaxLen > 0 {
+			s.add(spec.Name, "maxlen", strconv.Itoa(spec.MaxLen))
+		}
+
+		if spec.Default != "" {
+			if e := checkValue(spec.Name, spec.Name, Populate(spec.Default), s.kl, s.fl, s.vl); e != nil {
+				return nil, fmt.Errorf("bad default for key %s in schema: %v", spec.Name, e)
+			}
+
+			s.add(spec.Name, "default", spec.Default)
+		}
+
+		if spec.Deprecated != "" {
+			s.add(spec.Name, "deprecated", spec.Deprecated)
+		}
+
+		if spec.Warn {
+			s.add(spec.Name, "severity", "warn")
+		}
+
+		s.specs = append(s.specs, spec)
+	}
+
+	return s, nil
+}
+
+// add adds a key/field/value triple to the legals of s.
+func (s *Schema) add(key, field, val string) {
+	s.kl = append(s.kl, key)
+	s.fl = append(s.fl, field)
+	s.vl = append(s.vl, val)
+}
+
+// yesNo returns "yes" or "no".
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
+
+// Exclusive adds a group of keys to s of which at most one may be present.  name labels the group.
+func (s *Schema) Exclusive(name string, keys ...string) *Schema {
+	s.add(name, "exclusive", strings.Join(keys, ","))
+	return s
+}
+
+// Unknown sets how keys not in s are reported: "error" (the default), "warn" or "ignore".
+func (s *Schema) Unknown(severity string) *Schema {
+	s.add("*", "unknown", severity)
+	return s
+}
+
+// Keys returns the KeySpecs of s.
+func (s *Schema) Keys() []KeySpec {
+	return append([]KeySpec(nil), s.specs...)
+}
+
+// Legals returns s in the string format of BuildLegals, so it can be used with CheckLegals, NewParser, etc.
+func (s *Schema) Legals() string {
+	lines := make([]string, len(s.kl))
+	for ind := range s.kl {
+		lines[ind] = fmt.Sprintf("%s:%s-%s", s.kl[ind], s.fl[ind], s.vl[ind])
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Validate registers f to check the Value of key, and each of its duplicates, after the built-in checks.
+// A key may have several validators; they run in the order registered.
+func (s *Schema) Validate(key string, f func(key string, v *Value) error) *Schema {
+	if s.validators == nil {
+		s.validators = make(map[string][]func(key string, v *Value) error)
+	}
+
+	s.validators[key] = append(s.validators[key], f)
+
+	return s
+}
+
+// hooks returns the validators of s in the form used by checkLegals.
+func (s *Schema) hooks() map[string]func(*Value) error {
+	hooks := make(map[string]func(*Value) error)
+	for key, fs := range s.validators {
+		key, fs := key, fs
+		hooks[key] = func(v *Value) error {
+			for _, f := range fs {
+				if e := f(key, v); e != nil {
+					return e
+				}
+			}
+
+			return nil
+		}
+	}
+
+	return hooks
+}
+
+// ApplyDefaults adds the keys of s with a Default to kv if they are missing and not required.
+func (s *Schema) ApplyDefaults(kv KeyVal) {
+	applyDefaults(kv, s.kl, s.fl, s.vl, Options{})
+}
+
+// ApplyAliases renames the keys in kv that are deprecated in s and name their replacement.  See ApplyAliases.
+func (s *Schema) ApplyAliases(kv KeyVal) (warnings []string, err error) {
+	return applyAliases(kv, s.kl, s.fl, s.vl)
+}
+
+// Check checks kv against s, including the validators, and returns the first error.  Without validators,
+// it is CheckLegals(kv, s.Legals()).
+func (s *Schema) Check(kv KeyVal) error {
+	if errs, _ := checkLegals(kv, s.kl, s.fl, s.vl, s.hooks(), false); errs != nil {
+		return errs[0]
+	}
+
+	return nil
+}
+
+// CheckAll checks kv against s, including the validators, and reports every violation.  See CheckLegalsAll.
+func (s *Schema) CheckAll(kv KeyVal) *ValidationReport {
+	errs, warnings := checkLegals(kv, s.kl, s.fl, s.vl, s.hooks(), true)
+
+	return &ValidationReport{Errors: errs, Warnings: append(deprecations(kv, s.kl, s.fl, s.vl), warnings...)}
+}
@@ -0,0 +1,132 @@
+package keyval
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSchema(t *testing.T) {
+	schema, err := NewSchema(
+		KeySpec{Name: "host", Required: true},
+		KeySpec{Name: "port", Type: "int", Default: "5432"},
+		KeySpec{Name: "color", Values: []string{"red", "green"}, Requires: "host"},
+		KeySpec{Name: "tag", Multiple: true},
+	)
+	assert.Nil(t, err)
+	assert.Len(t, schema.Keys(), 4)
+
+	exp := `host:required-yes
+port:required-no
+port:type-int
+port:default-5432
+color:required-no
+color:values-red,green
+color:requires-host
+tag:required-no
+tag:multiple-yes`
+	assert.Equal(t, exp, schema.Legals())
+
+	kv, err := ReadKVString("host: localhost\nport: 80\ntag: a\ntag: b\n")
+	assert.Nil(t, err)
+	assert.Nil(t, schema.Check(kv))
+	assert.Nil(t, CheckLegals(kv, schema.Legals()))
+
+	kv["port"] = Populate("eighty")
+	assert.EqualError(t, schema.Check(kv), "value to key port must be integer")
+
+	kv, err = ReadKVString("color: blue\n")
+	assert.Nil(t, err)
+	assert.EqualError(t, schema.Check(kv), "missing required key host")
+
+	_, err = NewSchema(KeySpec{Name: "a b"})
+	assert.EqualError(t, err, `bad key name "a b" in schema`)
+
+	_, err = NewSchema(KeySpec{Name: "a"}, KeySpec{Name: "a"})
+	assert.EqualError(t, err, "key a is in schema more than once")
+
+	_, err = NewSchema(KeySpec{Name: "a", Type: "number"})
+	assert.EqualError(t, err, "unknown type number for key a in schema")
+
+	_, err = NewSchema(KeySpec{Name: "a", Values: []string{"x,y"}})
+	assert.EqualError(t, err, `value "x,y" for key a in schema has a comma`)
+
+	_, err = NewSchema(KeySpec{Name: "a", Min: "low"})
+	assert.EqualError(t, err, "bad min low for key a in schema")
+
+	dates, err := NewSchema(KeySpec{Name: "start", Type: "date", Min: "2023-01-01", Max: "2023-12-31"})
+	assert.Nil(t, err)
+	kv, err = ReadKVString("start: 2024-03-01\n")
+	assert.Nil(t, err)
+	assert.EqualError(t, dates.Check(kv), "value 2024-03-01 for key start is after max 2023-12-31")
+
+	mem, err := NewSchema(KeySpec{Name: "mem", Type: "bytes", Min: "1GB"})
+	assert.Nil(t, err)
+	assert.Nil(t, mem.Check(KeyVal{"mem": Populate("2GB")}))
+	assert.True(t, errors.Is(mem.Check(KeyVal{"mem": Populate("512MB")}), ErrIllegalValue))
+
+	share, err := NewSchema(KeySpec{Name: "share", Type: "percent", Max: "50%"})
+	assert.Nil(t, err)
+	assert.Nil(t, share.Check(KeyVal{"share": Populate("25%")}))
+	assert.True(t, errors.Is(share.Check(KeyVal{"share": Populate("75%")}), ErrIllegalValue))
+
+	_, err = NewSchema(KeySpec{Name: "a", Type: "int", Default: "x"})
+	assert.EqualError(t, err, "bad default for key a in schema: value to key a must be integer")
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := NewSchema(KeySpec{Name: "port", Type: "int"}, KeySpec{Name: "name"})
+	assert.Nil(t, err)
+
+	privileged := func(key string, v *Value) error {
+		if *v.AsInt < 1024 {
+			return fmt.Errorf("key %s: port %d is privileged", key, *v.AsInt)
+		}
+
+		return nil
+	}
+	notAdmin := func(key string, v *Value) error {
+		if strings.Trim(v.AsString, " ") == "admin" {
+			return fmt.Errorf("key %s: admin is reserved", key)
+		}
+
+		return nil
+	}
+	schema.Validate("port", privileged).Validate("name", notAdmin)
+
+	kv, err := ReadKVString("port: 8080\nname: app\n")
+	assert.Nil(t, err)
+	assert.Nil(t, schema.Check(kv))
+
+	kv["port"] = Populate("80")
+	kv["name"] = Populate("admin")
+	assert.EqualError(t, schema.Check(kv), "key name: admin is reserved")
+
+	report := schema.CheckAll(kv)
+	assert.Len(t, report.Errors, 2)
+	assert.EqualError(t, report.Errors[1], "key port: port 80 is privileged")
+
+	// the validator is not run on a value that fails the built-in checks
+	kv["port"] = Populate("http")
+	report = schema.CheckAll(kv)
+	assert.Len(t, report.Errors, 2)
+	assert.EqualError(t, report.Errors[0], "value to key port must be integer")
+}
+
+func TestSchema_Warn(t *testing.T) {
+	schema, err := NewSchema(KeySpec{Name: "port", Type: "int", Warn: true}, KeySpec{Name: "name", Required: true})
+	assert.Nil(t, err)
+	schema.Unknown("warn")
+
+	kv, err := ReadKVString("port: http\nname: app\nextra: 1\n")
+	assert.Nil(t, err)
+	assert.Nil(t, schema.Check(kv))
+
+	report := schema.CheckAll(kv)
+	assert.True(t, report.OK())
+	assert.Equal(t, []string{"value to key port must be integer", "unknown key(s): [extra]"}, report.Warnings)
+	assert.Contains(t, schema.Legals(), "port:severity-warn")
+}
@@ -0,0 +1,82 @@
+package keyval
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Template returns a keyval file documenting each key in legalKeys.  Each key is preceded by comments giving
+// its doc field, type, whether it is required and its legal values.  Required keys are set to their default,
+// if any.  Optional keys are commented out.  Deprecated keys are left out.
+//
+// A key is included if it has a required field.  See BuildLegals for the format of legalKeys.
+func Template(legalKeys string) (string, error) {
+	return TemplateOpts(legalKeys, Options{})
+}
+
+// TemplateOpts is Template using the delimiters, end of line and comment prefix of opts.
+func TemplateOpts(legalKeys string, opts Options) (string, error) {
+	kl, fl, vl, e := BuildLegals(legalKeys)
+	if e != nil {
+		return "", e
+	}
+
+	return template(kl, fl, vl, opts), nil
+}
+
+// template returns the template for the legals kl, fl, vl as returned by BuildLegals.
+func template(kl, fl, vl []string, opts Options) string {
+	var sb strings.Builder
+	seen := make(map[string]bool)
+	for ind, k := range kl {
+		if fl[ind] != "required" || seen[k] || getLgl(k, "deprecated", kl, fl, vl) != "" {
+			continue
+		}
+		seen[k] = true
+
+		if sb.Len() > 0 {
+			sb.WriteString(opts.lineEOL())
+		}
+
+		if doc := getLgl(k, "doc", kl, fl, vl); doc != "" {
+			writeComment(&sb, doc, opts)
+		}
+
+		vType := getLgl(k, "type", kl, fl, vl)
+		if vType == "" {
+			vType = "string"
+		}
+
+		required := vl[ind] == "yes"
+		info := fmt.Sprintf("type: %s, required: %s", vType, vl[ind])
+		if getLgl(k, "multiple", kl, fl, vl) == "yes" {
+			info += ", multiple: yes"
+		}
+		writeComment(&sb, info, opts)
+
+		if values := getLgl(k, "values", kl, fl, vl); values != "" {
+			writeComment(&sb, "values: "+values, opts)
+		}
+
+		bounds := []string{"min", "max", "minlen", "maxlen", "match", "matchfull", "pattern", "requires", "conflicts"}
+		for _, bound := range bounds {
+			if lim := getLgl(k, bound, kl, fl, vl); lim != "" {
+				writeComment(&sb, fmt.Sprintf("%s: %s", bound, lim), opts)
+			}
+		}
+
+		line := fmt.Sprintf("%s%s %s", k, opts.kvDelim(), getLgl(k, "default", kl, fl, vl))
+		if !required {
+			line = opts.commentPrefix() + " " + line
+		}
+
+		sb.WriteString(strings.TrimRight(line, " ") + opts.lineEOL())
+	}
+
+	return sb.String()
+}
+
+// writeComment writes text to sb as a comment.
+func writeComment(sb *strings.Builder, text string, opts Options) {
+	sb.WriteString(opts.commentPrefix() + " " + text + opts.lineEOL())
+}
@@ -0,0 +1,45 @@
+package keyval
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplate(t *testing.T) {
+	const legalDefs = `
+host:required-yes
+host:doc-the database host
+port:required-no
+port:type-int
+port:min-1
+port:max-65535
+port:default-5432
+color:required-no
+color:values-red,green
+color:multiple-yes
+old:required-no
+old:deprecated-yes
+group:oneof-host,color`
+
+	tmpl, err := Template(legalDefs)
+	assert.Nil(t, err)
+
+	exp := `// the database host
+// type: string, required: yes
+host:
+
+// type: int, required: no
+// min: 1
+// max: 65535
+// port: 5432
+
+// type: string, required: no, multiple: yes
+// values: red,green
+// color:
+`
+	assert.Equal(t, exp, tmpl)
+
+	_, err = Template("host:bogus-yes")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,410 @@
+package keyval
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FromTOML reads a TOML document from r and returns it as a KeyVal.  Tables and dotted keys are flattened
+// into dot keys, so key "port" in table [db] becomes "db.port".  Arrays become slice values.  The leaves are
+// converted by Populate.
+//
+// Strings, numbers, bools, dates, arrays, tables and inline tables are supported.  Arrays of tables are not.
+func FromTOML(r io.Reader) (KeyVal, error) {
+	src, e := io.ReadAll(r)
+	if e != nil {
+		return nil, e
+	}
+
+	p := &tomlParser{src: strings.ReplaceAll(string(src), "\r\n", "\n")}
+	obj, e := p.parse()
+	if e != nil {
+		return nil, e
+	}
+
+	return fromTree("toml", obj)
+}
+
+// tomlParser parses a TOML document into nested maps.  Leaves are strings, int64, float64 or bool.  Dates
+// are left as strings for Populate to convert.
+type tomlParser struct {
+	src string
+	pos int
+}
+
+// errorf returns an error at the current line.
+func (p *tomlParser) errorf(format string, args ...any) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("bad toml at line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// peek returns the next byte, or 0 at the end of the document.
+func (p *tomlParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+
+	return 0
+}
+
+// skipSpace skips spaces and tabs.
+func (p *tomlParser) skipSpace() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.pos++
+	}
+}
+
+// skipBlank skips spaces, tabs, comments and newlines.
+func (p *tomlParser) skipBlank() {
+	for {
+		p.skipSpace()
+		switch p.peek() {
+		case '#':
+			for p.peek() != '\n' && p.peek() != 0 {
+				p.pos++
+			}
+		case '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// endLine checks that only a comment remains on the line and moves past it.
+func (p *tomlParser) endLine() error {
+	p.skipSpace()
+	if p.peek() == '#' {
+		for p.peek() != '\n' && p.peek() != 0 {
+			p.pos++
+		}
+	}
+
+	switch p.peek() {
+	case '\n':
+		p.pos++
+	case 0:
+	default:
+		return p.errorf("unexpected %q", p.peek())
+	}
+
+	return nil
+}
+
+func (p *tomlParser) parse() (map[string]any, error) {
+	root := make(map[string]any)
+	current := root
+	for p.skipBlank(); p.peek() != 0; p.skipBlank() {
+		if p.peek() == '[' {
+			p.pos++
+			if p.peek() == '[' {
+				return nil, p.errorf("arrays of tables are not supported")
+			}
+
+			path, e := p.parseKey()
+			if e != nil {
+				return nil, e
+			}
+
+			if p.skipSpace(); p.peek() != ']' {
+				return nil, p.errorf("table header is not closed")
+			}
+			p.pos++
+
+			if current, e = p.table(root, path); e != nil {
+				return nil, e
+			}
+
+			if e := p.endLine(); e != nil {
+				return nil, e
+			}
+
+			continue
+		}
+
+		if e := p.parseKeyVal(current); e != nil {
+			return nil, e
+		}
+
+		if e := p.endLine(); e != nil {
+			return nil, e
+		}
+	}
+
+	return root, nil
+}
+
+// table returns the table at path below tbl, creating it if needed.
+func (p *tomlParser) table(tbl map[string]any, path []string) (map[string]any, error) {
+	for _, name := range path {
+		switch sub := tbl[name].(type) {
+		case nil:
+			next := make(map[string]any)
+			tbl[name], tbl = next, next
+		case map[string]any:
+			tbl = sub
+		default:
+			return nil, p.errorf("key %s is not a table", name)
+		}
+	}
+
+	return tbl, nil
+}
+
+// parseKeyVal parses a key = value pair into tbl.
+func (p *tomlParser) parseKeyVal(tbl map[string]any) error {
+	path, e := p.parseKey()
+	if e != nil {
+		return e
+	}
+
+	if p.skipSpace(); p.peek() != '=' {
+		return p.errorf("missing = after key %s", strings.Join(path, "."))
+	}
+	p.pos++
+	p.skipSpace()
+
+	val, e := p.parseValue()
+	if e != nil {
+		return e
+	}
+
+	if tbl, e = p.table(tbl, path[:len(path)-1]); e != nil {
+		return e
+	}
+
+	name := path[len(path)-1]
+	if _, ok := tbl[name]; ok {
+		return p.errorf("duplicate key %s", strings.Join(path, "."))
+	}
+	tbl[name] = val
+
+	return nil
+}
+
+// parseKey parses a key, which may be dotted, into its parts.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var path []string
+	for {
+		p.skipSpace()
+		var (
+			part string
+			e    error
+		)
+
+		switch p.peek() {
+		case '"', '\'':
+			if part, e = p.parseString(); e != nil {
+				return nil, e
+			}
+		default:
+			start := p.pos
+			for c := p.peek(); c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+				c >= '0' && c <= '9'; c = p.peek() {
+				p.pos++
+			}
+
+			if part = p.src[start:p.pos]; part == "" {
+				return nil, p.errorf("missing key")
+			}
+		}
+
+		path = append(path, part)
+		if p.skipSpace(); p.peek() != '.' {
+			return path, nil
+		}
+		p.pos++
+	}
+}
+
+// parseValue parses a value.
+func (p *tomlParser) parseValue() (any, error) {
+	switch p.peek() {
+	case '"', '\'':
+		return p.parseString()
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+
+	start := p.pos
+	for c := p.peek(); c != 0 && !strings.ContainsRune(",]}#\n", rune(c)); c = p.peek() {
+		p.pos++
+	}
+
+	tok := strings.TrimRight(p.src[start:p.pos], " \t")
+	switch {
+	case tok == "true" || tok == "false":
+		return tok == "true", nil
+	case tok == "":
+		return nil, p.errorf("missing value")
+	}
+
+	if i, e := strconv.ParseInt(tok, 0, 64); e == nil {
+		return i, nil
+	}
+
+	if f, e := strconv.ParseFloat(tok, 64); e == nil {
+		return f, nil
+	}
+
+	// dates and times are converted by Populate
+	if tok[0] >= '0' && tok[0] <= '9' && strings.ContainsAny(tok, "-:") {
+		return tok, nil
+	}
+
+	return nil, p.errorf("bad value %s", tok)
+}
+
+// parseString parses a basic, literal or multi-line string.
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.src[p.pos : p.pos+1]
+	multi := strings.HasPrefix(p.src[p.pos:], strings.Repeat(quote, 3))
+
+	delim := quote
+	if multi {
+		delim = strings.Repeat(quote, 3)
+	}
+	p.pos += len(delim)
+
+	// a newline right after the opening delimiter of a multi-line string is not part of it
+	if multi && p.peek() == '\n' {
+		p.pos++
+	}
+
+	start := p.pos
+	for !strings.HasPrefix(p.src[p.pos:], delim) {
+		c := p.peek()
+		if c == 0 || c == '\n' && !multi {
+			return "", p.errorf("string is not closed")
+		}
+
+		// skip the escaped character so an escaped quote does not end the string
+		if c == '\\' && quote == `"` && p.pos+1 < len(p.src) {
+			p.pos++
+		}
+		p.pos++
+	}
+
+	raw := p.src[start:p.pos]
+	p.pos += len(delim)
+
+	if quote == "'" {
+		return raw, nil
+	}
+
+	str, ok := tomlUnescape(raw)
+	if !ok {
+		return "", p.errorf("bad escape in string %s", raw)
+	}
+
+	return str, nil
+}
+
+// tomlUnescape replaces the escapes in the basic string raw.  A backslash at the end of a line removes the
+// newline and the whitespace that follows.
+func tomlUnescape(raw string) (string, bool) {
+	var sb strings.Builder
+	for ind := 0; ind < len(raw); ind++ {
+		if raw[ind] != '\\' {
+			sb.WriteByte(raw[ind])
+			continue
+		}
+
+		if ind++; ind == len(raw) {
+			return "", false
+		}
+
+		switch c := raw[ind]; c {
+		case 'b', 't', 'n', 'f', 'r':
+			sb.WriteByte(map[byte]byte{'b': '\b', 't': '\t', 'n': '\n', 'f': '\f', 'r': '\r'}[c])
+		case '"', '\\':
+			sb.WriteByte(c)
+		case 'u', 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+
+			if ind+size >= len(raw) {
+				return "", false
+			}
+
+			code, e := strconv.ParseUint(raw[ind+1:ind+1+size], 16, 32)
+			if e != nil {
+				return "", false
+			}
+
+			sb.WriteRune(rune(code))
+			ind += size
+		case ' ', '\t', '\n':
+			rest := strings.TrimLeft(raw[ind:], " \t")
+			if !strings.HasPrefix(rest, "\n") {
+				return "", false
+			}
+
+			ind = len(raw) - len(strings.TrimLeft(rest, " \t\n")) - 1
+		default:
+			return "", false
+		}
+	}
+
+	return sb.String(), true
+}
+
+// parseArray parses an array, which may span lines.
+func (p *tomlParser) parseArray() ([]any, error) {
+	p.pos++
+
+	arr := make([]any, 0)
+	for {
+		if p.skipBlank(); p.peek() == ']' {
+			p.pos++
+			return arr, nil
+		}
+
+		val, e := p.parseValue()
+		if e != nil {
+			return nil, e
+		}
+		arr = append(arr, val)
+
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("array is not closed")
+		}
+	}
+}
+
+// parseInlineTable parses an inline table.
+func (p *tomlParser) parseInlineTable() (map[string]any, error) {
+	p.pos++
+
+	tbl := make(map[string]any)
+	for {
+		if p.skipSpace(); p.peek() == '}' {
+			p.pos++
+			return tbl, nil
+		}
+
+		if e := p.parseKeyVal(tbl); e != nil {
+			return nil, e
+		}
+
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+		default:
+			return nil, p.errorf("inline table is not closed")
+		}
+	}
+}
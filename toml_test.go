@@ -0,0 +1,57 @@
+package keyval
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromTOML(t *testing.T) {
+	const content = `
+# service
+name = "app"   # inline comment
+path = 'C:\temp'
+motd = """
+hello \
+  world\tbye"""
+
+[db]
+port = 5_432
+hosts = [
+  "a", # first
+  "b",
+]
+opts = { ssl = true, timeout = "30s" }
+start = 2023-01-15
+
+[db.limits]
+rate.max = 1.5
+`
+	kv, err := FromTOML(strings.NewReader(content))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"db.hosts", "db.limits.rate.max", "db.opts.ssl", "db.opts.timeout", "db.port",
+		"db.start", "motd", "name", "path"}, kv.Keys())
+	assert.Equal(t, "app", kv.GetTrim("name"))
+	assert.Equal(t, `C:\temp`, kv.GetTrim("path"))
+	assert.Equal(t, "hello world\tbye", kv.Get("motd").AsString)
+	assert.Equal(t, 5432, *kv.Get("db.port").AsInt)
+	assert.Equal(t, []string{"a", "b"}, kv.Get("db.hosts").AsSliceS)
+	assert.True(t, *kv.Get("db.opts.ssl").AsBool)
+	assert.Equal(t, "30s", kv.Get("db.opts.timeout").String())
+	assert.Equal(t, "2023-01-15", kv.Get("db.start").AsDate.Format("2006-01-02"))
+	assert.Equal(t, 1.5, *kv.Get("db.limits.rate.max").AsFloat)
+
+	for content, msg := range map[string]string{
+		"a = 1\na = 2":       "bad toml at line 2: duplicate key a",
+		"a = \"open\nb = 1":  "bad toml at line 1: string is not closed",
+		"[[servers]]\n":      "bad toml at line 1: arrays of tables are not supported",
+		"a = 1 2\n":          "bad toml at line 1: bad value 1 2",
+		"a = 1\n[a]\nb = 2":  "bad toml at line 2: key a is not a table",
+		"a = [1, {b = 2}]\n": "element 2 of toml array a is not a number, string or bool",
+	} {
+		_, err = FromTOML(strings.NewReader(content))
+		assert.EqualError(t, err, msg, content)
+	}
+}
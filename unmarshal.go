@@ -0,0 +1,153 @@
+package keyval
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Unmarshal stores the values of kv in the struct pointed to by dest.  A field is filled from the key given
+// by its "keyval" tag or, if it has no tag, from the key with the field's name.  Fields with the tag "-"
+// and fields whose key is not in kv are left alone.
+//
+// The supported field types are string, the int types, float32, float64, bool, time.Time, time.Duration and
+// slices of string, int, float64, bool, time.Time and time.Duration.  The populated elements of the Value
+// (AsInt, AsSliceD, etc.) are used, so it is an error if the value cannot be represented as the field's type.
+// A string field, including one of a named string type, is set to the value trimmed of spaces, as GetString
+// returns it.  An int field may also be set from a byte size, such as 512MB, as the number of bytes, and a
+// float or []float64 field from percents, such as 75%, as fractions.  A *big.Rat field is set from a decimal
+// number.
+func (kv KeyVal) Unmarshal(dest any) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("destination must be a non-nil pointer to a struct, got %T", dest)
+	}
+
+	rv = rv.Elem()
+	rt := rv.Type()
+	for ind := 0; ind < rt.NumField(); ind++ {
+		field := rt.Field(ind)
+		if !field.IsExported() {
+			continue
+		}
+
+		key := field.Name
+		if tag, ok := field.Tag.Lookup("keyval"); ok {
+			key = tag
+		}
+
+		if key == "-" {
+			continue
+		}
+
+		val := kv.Get(key)
+		if val == nil {
+			continue
+		}
+
+		if e := setField(rv.Field(ind), val); e != nil {
+			return fmt.Errorf("key %s: %v", key, e)
+		}
+	}
+
+	return nil
+}
+
+// setField sets fld to the element of val of the same type.
+func setField(fld reflect.Value, val *Value) error {
+	var (
+		data any
+		e    error
+	)
+
+	switch fld.Interface().(type) {
+	case time.Time:
+		data, e = val.GetAs(Date)
+	case bool:
+		data, e = val.GetAs(Bool)
+	case time.Duration:
+		data, e = val.GetAs(Duration)
+	case *big.Rat:
+		// the KeyVal need not be read with Decimal set
+		dec := toDecimal(val.AsString)
+		if dec == nil {
+			return fmt.Errorf("value cannot be represented as %v", Decimal)
+		}
+		data = dec
+	case []string:
+		data, e = val.GetAs(SliceStr)
+	case []int:
+		data, e = val.GetAs(SliceInt)
+	case []float64:
+		if data, e = val.GetAs(SliceFloat); e != nil && val.AsSlicePct != nil {
+			data, e = val.AsSlicePct, nil
+		}
+	case []time.Time:
+		data, e = val.GetAs(SliceDate)
+	case []bool:
+		data, e = val.GetAs(SliceBool)
+	case []time.Duration:
+		data, e = val.GetAs(SliceDuration)
+	default:
+		switch fld.Kind() {
+		case reflect.String:
+			// trimmed, as GetString gives it
+			fld.SetString(strings.Trim(val.AsString, " "))
+			return nil
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			// a byte size, such as 512MB, sets an int field to the number of bytes
+			if val.Resolve(); val.AsInt == nil && val.AsBytes != nil {
+				if fld.OverflowInt(*val.AsBytes) {
+					return fmt.Errorf("value %s overflows %v", val.AsString, fld.Type())
+				}
+
+				fld.SetInt(*val.AsBytes)
+
+				return nil
+			}
+
+			if data, e = val.GetAs(Int); e == nil {
+				if fld.OverflowInt(int64(*data.(*int))) {
+					return fmt.Errorf("value %s overflows %v", val.AsString, fld.Type())
+				}
+
+				fld.SetInt(int64(*data.(*int)))
+			}
+
+			return e
+		case reflect.Float32, reflect.Float64:
+			// a percent, such as 75%, sets a float field to the fraction
+			if val.Resolve(); val.AsFloat == nil && val.AsPercent != nil {
+				fld.SetFloat(*val.AsPercent)
+				return nil
+			}
+
+			if data, e = val.GetAs(Float); e == nil {
+				fld.SetFloat(*data.(*float64))
+			}
+
+			return e
+		}
+
+		return fmt.Errorf("unsupported field type %v", fld.Type())
+	}
+
+	if e != nil {
+		return e
+	}
+
+	switch d := data.(type) {
+	case *time.Time:
+		fld.Set(reflect.ValueOf(*d))
+	case *bool:
+		fld.SetBool(*d)
+	case *time.Duration:
+		fld.SetInt(int64(*d))
+	default:
+		fld.Set(reflect.ValueOf(d))
+	}
+
+	return nil
+}
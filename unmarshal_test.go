@@ -0,0 +1,99 @@
+package keyval
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyVal_Unmarshal(t *testing.T) {
+	type config struct {
+		Name    string
+		Port    int             `keyval:"port"`
+		Workers int8            `keyval:"workers"`
+		Rate    float64         `keyval:"rate"`
+		Start   time.Time       `keyval:"start"`
+		Hosts   []string        `keyval:"hosts"`
+		Ports   []int           `keyval:"ports"`
+		Weights []float64       `keyval:"weights"`
+		Debug   bool            `keyval:"debug"`
+		Flags   []bool          `keyval:"flags"`
+		Timeout time.Duration   `keyval:"timeout"`
+		Retries []time.Duration `keyval:"retries"`
+		Skip    string          `keyval:"-"`
+		Absent  string          `keyval:"absent"`
+	}
+
+	kv, err := ReadKVString(`Name: app
+port: 8080
+workers: 4
+rate: 2
+start: 20231015
+hosts: a, b
+ports: 80, 443
+weights: 1, 2.5
+debug: yes
+flags: on, off
+timeout: 30s
+retries: 1s, 2m
+Skip: no
+`)
+	assert.Nil(t, err)
+
+	cfg := config{Absent: "kept"}
+	assert.Nil(t, kv.Unmarshal(&cfg))
+
+	exp := config{
+		Name:    "app",
+		Port:    8080,
+		Workers: 4,
+		Rate:    2,
+		Start:   time.Date(2023, 10, 15, 0, 0, 0, 0, time.UTC),
+		Hosts:   []string{"a", "b"},
+		Ports:   []int{80, 443},
+		Weights: []float64{1, 2.5},
+		Debug:   true,
+		Flags:   []bool{true, false},
+		Timeout: 30 * time.Second,
+		Retries: []time.Duration{time.Second, 2 * time.Minute},
+		Absent:  "kept",
+	}
+	assert.Equal(t, exp, cfg)
+
+	kv["port"] = Populate("http")
+	assert.EqualError(t, kv.Unmarshal(&cfg), "key port: value cannot be represented as Int")
+
+	kv["port"] = Populate("8080")
+	kv["workers"] = Populate("300")
+	assert.EqualError(t, kv.Unmarshal(&cfg), "key workers: value 300 overflows int8")
+
+	kv["workers"] = Populate("1KB")
+	assert.EqualError(t, kv.Unmarshal(&cfg), "key workers: value 1KB overflows int8")
+
+	var limits struct {
+		Price  *big.Rat  `keyval:"price"`
+		Mem    int64     `keyval:"mem"`
+		Load   float64   `keyval:"load"`
+		Splits []float64 `keyval:"splits"`
+	}
+	assert.Nil(t, KeyVal{"mem": Populate("2GiB"), "load": Populate("75%"), "splits": Populate("10%, 90%"),
+		"price": Populate("19.99")}.Unmarshal(&limits))
+	assert.Equal(t, big.NewRat(1999, 100), limits.Price)
+	assert.Equal(t, int64(2<<30), limits.Mem)
+	assert.Equal(t, 0.75, limits.Load)
+	assert.Equal(t, []float64{0.1, 0.9}, limits.Splits)
+
+	assert.EqualError(t, kv.Unmarshal(cfg), "destination must be a non-nil pointer to a struct, got keyval.config")
+
+	// strings are trimmed, including named string types
+	type level string
+	var logging struct {
+		Name  string `keyval:"name"`
+		Level level  `keyval:"level"`
+	}
+	assert.Nil(t, KeyVal{"name": Populate("  app "), "level": Populate(" debug")}.Unmarshal(&logging))
+	assert.Equal(t, "app", logging.Name)
+	assert.Equal(t, level("debug"), logging.Level)
+}
@@ -0,0 +1,173 @@
+package keyval
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Watcher reloads a keyval file when it, or one of its includes, changes.  The files are polled for a change
+// in their modification time or size.  On a change, the file is parsed and checked by a Parser and the
+// callback is called with the new KeyVal or the error.  If there is an error, Current keeps returning the
+// last good KeyVal.
+//
+// Includes that are URLs are not watched.  With the FS option, the files are looked for in FS.  A Parser with
+// an IncludeResolver can't be watched, since there is no way to tell if its files have changed.
+type Watcher struct {
+	specFile string
+	parser   *Parser
+	onChange func(kv KeyVal, err error)
+
+	// pollMu keeps polls in order and guards stamps; mu guards current and is not held while reading files
+	pollMu  sync.Mutex
+	stamps  map[string]fileStamp
+	mu      sync.Mutex
+	current KeyVal
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// fileStamp is what the Watcher compares to see if a file has changed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher parses specFile with p and starts polling it and its includes every interval.  onChange is called
+// after each reload.  An error is returned if p has an IncludeResolver or the first parse fails.  Call Stop
+// when done.
+func NewWatcher(specFile string, p *Parser, interval time.Duration, onChange func(kv KeyVal, err error)) (*Watcher,
+	error) {
+	if p.opts.IncludeResolver != nil {
+		return nil, fmt.Errorf("can't watch %s: files opened by an IncludeResolver can't be watched", specFile)
+	}
+
+	w := &Watcher{specFile: specFile, parser: p, onChange: onChange, stop: make(chan struct{}),
+		done: make(chan struct{})}
+
+	kv, files, e := w.parse()
+	if e != nil {
+		return nil, e
+	}
+	w.current, w.stamps = kv, w.stampFiles(files)
+
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.Poll()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+
+	return w, nil
+}
+
+// Current returns the last KeyVal that parsed without error.
+func (w *Watcher) Current() KeyVal {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.current
+}
+
+// Poll checks the files now and reloads if any has changed.  It returns true if there was a reload, whether
+// or not it succeeded.
+func (w *Watcher) Poll() bool {
+	w.pollMu.Lock()
+	defer w.pollMu.Unlock()
+
+	names := make([]string, 0, len(w.stamps))
+	changed := false
+	for name, stamp := range w.stamps {
+		names = append(names, name)
+		if w.stampFile(name) != stamp {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return false
+	}
+
+	kv, files, e := w.parse()
+
+	if e != nil {
+		// keep watching the files of the last good parse so the fix is seen
+		w.stamps = w.stampFiles(names)
+	} else {
+		w.stamps = w.stampFiles(files)
+		w.mu.Lock()
+		w.current = kv
+		w.mu.Unlock()
+	}
+
+	// the callback may call Current
+	if w.onChange != nil {
+		w.onChange(kv, e)
+	}
+
+	return true
+}
+
+// Stop stops the polling.  It may be called more than once.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
+
+// parse parses the file and returns the names of the files read, including the includes.
+func (w *Watcher) parse() (kv KeyVal, files []string, err error) {
+	p := *w.parser
+	p.opts.opened = func(name string) {
+		if !isURL(name) {
+			files = append(files, name)
+		}
+	}
+
+	kv, err = p.ParseFile(w.specFile)
+
+	return kv, files, err
+}
+
+// stampFiles returns the stamps of files.
+func (w *Watcher) stampFiles(files []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, name := range files {
+		stamps[name] = w.stampFile(name)
+	}
+
+	return stamps
+}
+
+// stampFile returns the stamp of the file name, which is in the FS of the Parser if it has one.  The stamp is
+// zero if the file can't be read.
+func (w *Watcher) stampFile(name string) fileStamp {
+	var (
+		info fs.FileInfo
+		e    error
+	)
+
+	if w.parser.opts.FS != nil {
+		info, e = fs.Stat(w.parser.opts.FS, name)
+	} else {
+		info, e = os.Stat(name)
+	}
+
+	if e != nil {
+		return fileStamp{}
+	}
+
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
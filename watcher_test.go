@@ -0,0 +1,140 @@
+package keyval
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	main, sub := filepath.Join(dir, "main.txt"), filepath.Join(dir, "sub.txt")
+	assert.Nil(t, os.WriteFile(main, []byte("host: localhost\ninclude: "+sub+"\n"), 0644))
+	assert.Nil(t, os.WriteFile(sub, []byte("port: 80\n"), 0644))
+
+	p, err := NewParser("host:required-yes\nport:required-no\nport:type-int")
+	assert.Nil(t, err)
+
+	var (
+		gotKV  KeyVal
+		gotErr error
+	)
+	w, err := NewWatcher(main, p, time.Hour, func(kv KeyVal, err error) { gotKV, gotErr = kv, err })
+	assert.Nil(t, err)
+	defer w.Stop()
+
+	assert.Equal(t, 80, *w.Current().Get("port").AsInt)
+	assert.False(t, w.Poll())
+
+	// a change to an include is seen
+	assert.Nil(t, os.WriteFile(sub, []byte("port: 8080\n"), 0644))
+	assert.True(t, w.Poll())
+	assert.Nil(t, gotErr)
+	assert.Equal(t, 8080, *gotKV.Get("port").AsInt)
+	assert.Equal(t, 8080, *w.Current().Get("port").AsInt)
+
+	// a bad file keeps the old KeyVal
+	assert.Nil(t, os.WriteFile(sub, []byte("port: https\n"), 0644))
+	assert.True(t, w.Poll())
+	assert.EqualError(t, gotErr, "value to key port must be integer")
+	assert.Nil(t, gotKV)
+	assert.Equal(t, 8080, *w.Current().Get("port").AsInt)
+	assert.False(t, w.Poll())
+
+	assert.Nil(t, os.WriteFile(sub, []byte("port: 9090\n"), 0644))
+	assert.True(t, w.Poll())
+	assert.Equal(t, 9090, *w.Current().Get("port").AsInt)
+
+	_, err = NewWatcher(filepath.Join(dir, "missing.txt"), p, time.Hour, nil)
+	assert.NotNil(t, err)
+}
+
+func TestWatcher_Interval(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "main.txt")
+	assert.Nil(t, os.WriteFile(fileName, []byte("port: 80\n"), 0644))
+
+	p, err := NewParser("port:required-yes")
+	assert.Nil(t, err)
+
+	reloaded := make(chan KeyVal, 1)
+	w, err := NewWatcher(fileName, p, 10*time.Millisecond, func(kv KeyVal, err error) { reloaded <- kv })
+	assert.Nil(t, err)
+	defer w.Stop()
+
+	assert.Nil(t, os.WriteFile(fileName, []byte("port: 8080\n"), 0644))
+	select {
+	case kv := <-reloaded:
+		assert.Equal(t, 8080, *kv.Get("port").AsInt)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload")
+	}
+}
+
+// blockingFS is an fs.FS whose Open waits for release while block is set.  Stat doesn't wait.
+type blockingFS struct {
+	fs.FS
+	block   bool
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingFS) Open(name string) (fs.File, error) {
+	if b.block {
+		b.entered <- struct{}{}
+		<-b.release
+	}
+
+	return b.FS.Open(name)
+}
+
+func (b *blockingFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(b.FS, name)
+}
+
+func TestWatcher_PollUnlocked(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "main.txt"), []byte("port: 80\n"), 0644))
+
+	fsys := &blockingFS{FS: os.DirFS(dir), entered: make(chan struct{}), release: make(chan struct{})}
+	p, err := NewParser("port:required-yes", WithOptions(Options{FS: fsys}))
+	assert.Nil(t, err)
+
+	w, err := NewWatcher("main.txt", p, time.Hour, nil)
+	assert.Nil(t, err)
+
+	// a change to a file in the FS is seen
+	fsys.block = true
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "main.txt"), []byte("port: 8080\n"), 0644))
+	polled := make(chan bool)
+	go func() { polled <- w.Poll() }()
+	<-fsys.entered
+
+	// Current doesn't wait for the parse
+	current := make(chan KeyVal)
+	go func() { current <- w.Current() }()
+	select {
+	case kv := <-current:
+		assert.Equal(t, "80", kv.Get("port").AsString)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Current blocked by Poll")
+	}
+
+	close(fsys.release)
+	assert.True(t, <-polled)
+	assert.Equal(t, "8080", w.Current().Get("port").AsString)
+
+	w.Stop()
+	w.Stop()
+
+	// files opened by a resolver can't be watched
+	resolver := func(name string) (io.ReadCloser, error) { return os.Open(name) }
+	p, err = NewParser("port:required-yes", WithOptions(Options{IncludeResolver: resolver}))
+	assert.Nil(t, err)
+	_, err = NewWatcher("main.txt", p, time.Hour, nil)
+	assert.EqualError(t, err, "can't watch main.txt: files opened by an IncludeResolver can't be watched")
+}
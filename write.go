@@ -0,0 +1,83 @@
+package keyval
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Write writes kv to w in the keyval file format, one "key: value" line per key, in the order of Keys.
+// Duplicate keys are written under their root key, in order, so reading the output gives back kv.  Values
+// that were quoted are quoted again, as are values with a comment, a line break or a leading or trailing quote.
+// The Comment of a Value is written above its key as // comments.
+func (kv KeyVal) Write(w io.Writer) error {
+	return kv.WriteOpts(w, Options{})
+}
+
+// WriteOpts is Write using the delimiters, end of line and comment prefix of opts.
+func (kv KeyVal) WriteOpts(w io.Writer, opts Options) error {
+	roots := make([]string, 0, len(kv))
+	seen := make(map[string]bool)
+	for _, k := range kv.Keys() {
+		root := kv.rootKey(k)
+		if !seen[root] {
+			seen[root] = true
+			roots = append(roots, root)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, root := range roots {
+		for _, key := range kv.multipleKeys(root) {
+			if kv[key].Comment != "" {
+				for _, line := range strings.Split(kv[key].Comment, "\n") {
+					if _, e := fmt.Fprintf(bw, "%s %s%s", opts.commentPrefix(), line, opts.lineEOL()); e != nil {
+						return e
+					}
+				}
+			}
+
+			line := fmt.Sprintf("%s%s %s%s", root, opts.kvDelim(), writeValue(kv[key], opts), opts.lineEOL())
+			if _, e := bw.WriteString(line); e != nil {
+				return e
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// WriteFile writes kv to the file fileName.  See Write.
+func (kv KeyVal) WriteFile(fileName string) error {
+	return kv.WriteFileOpts(fileName, Options{})
+}
+
+// WriteFileOpts writes kv to the file fileName using opts.  See WriteOpts.
+func (kv KeyVal) WriteFileOpts(fileName string, opts Options) error {
+	handle, e := os.Create(fileName)
+	if e != nil {
+		return e
+	}
+
+	if e := kv.WriteOpts(handle, opts); e != nil {
+		_ = handle.Close()
+		return e
+	}
+
+	return handle.Close()
+}
+
+// writeValue returns v as it is written to a file using opts.  A value that was a quoted string is quoted, as is
+// one that would not read back as it is: one with a comment, a line break or a leading or trailing quote.
+func writeValue(v *Value, opts Options) string {
+	str := v.AsString
+	if v.quoted || strings.ContainsAny(str, "\n\r") || strings.Contains(str, opts.lineEOL()) ||
+		commentIndex(str, opts.commentPrefix()) >= 0 || strings.HasPrefix(str, `"`) || strings.HasSuffix(str, `"`) {
+		return strconv.Quote(str)
+	}
+
+	return str
+}
@@ -0,0 +1,134 @@
+package keyval
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyVal_Write(t *testing.T) {
+	kv, err := ReadKVString("b: x, y\na: 1\neqn: a=b\neqn: b=c\nc: 20230101\nq: \"x, y\"\n")
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, kv.Write(&buf))
+	assert.Equal(t, "b: x, y\na: 1\neqn: a=b\neqn: b=c\nc: 20230101\nq: \"x, y\"\n", buf.String())
+
+	fileName := filepath.Join(t.TempDir(), "out.txt")
+	assert.Nil(t, kv.WriteFile(fileName))
+
+	back, err := ReadKV(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, kv, back)
+}
+
+func TestKeyVal_WriteComments(t *testing.T) {
+	kv, err := ReadKVString(`// connection settings
+// for the primary
+host: localhost // the db host
+port: 5432
+// trailing comment with no key
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, "connection settings\nfor the primary\nthe db host", kv.Get("host").Comment)
+	assert.Equal(t, "", kv.Get("port").Comment)
+
+	var buf bytes.Buffer
+	assert.Nil(t, kv.Write(&buf))
+	assert.Equal(t, "// connection settings\n// for the primary\n// the db host\nhost: localhost\nport: 5432\n", buf.String())
+
+	back, err := ReadKVString(buf.String())
+	assert.Nil(t, err)
+	assert.Equal(t, kv, back)
+}
+
+func TestKeyVal_WriteManyDuplicates(t *testing.T) {
+	// the roots of a12 and v1 are not guessed from their names
+	src := strings.Repeat("a: x\n", 12) + "v: 1\nv1: 2\nv2: 3\n"
+	kv, err := ReadKVString(src)
+	assert.Nil(t, err)
+	assert.Len(t, kv, 15)
+	assert.Len(t, kv.GetMultiple("a"), 12)
+
+	var buf bytes.Buffer
+	assert.Nil(t, kv.Write(&buf))
+	assert.Equal(t, src, buf.String())
+
+	back, err := ReadKVString(buf.String())
+	assert.Nil(t, err)
+	assert.Equal(t, kv, back)
+
+	act, err := json.Marshal(kv)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"a":["x","x","x","x","x","x","x","x","x","x","x","x"],"v":1,"v1":2,"v2":3}`, string(act))
+
+	merged := KeyVal{"a": Populate("y")}.Merge(kv, MergeAppend)
+	assert.Len(t, merged.GetMultiple("a"), 13)
+	buf.Reset()
+	assert.Nil(t, merged.Write(&buf))
+	assert.Equal(t, 13, strings.Count(buf.String(), "a: "))
+}
+
+func TestKeyVal_WriteHandBuilt(t *testing.T) {
+	port := 8080
+	kv := KeyVal{
+		"port":  &Value{AsString: "8080", AsInt: &port, BestType: Int},
+		"name":  &Value{AsString: "app", BestType: String},
+		"title": Populate(`"a, b"`),
+		"lazy":  populate(`"c, d"`, Options{LazyPopulate: true}),
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, kv.Write(&buf))
+	back, err := ReadKVString(buf.String())
+	assert.Nil(t, err)
+	assert.Equal(t, 8080, *back.Get("port").AsInt)
+	assert.Equal(t, "app", back.GetTrim("name"))
+	assert.Equal(t, "a, b", back.Get("title").AsString)
+	assert.Equal(t, String, back.Get("title").BestType)
+	assert.Equal(t, "c, d", back.Get("lazy").AsString)
+	assert.Contains(t, buf.String(), "port: 8080\n")
+	assert.Contains(t, buf.String(), "name: app\n")
+	assert.Contains(t, buf.String(), `title: "a, b"`+"\n")
+}
+
+func TestKeyVal_WriteQuotes(t *testing.T) {
+	kv := KeyVal{
+		"note":  Populate("see // here"),
+		"lines": Populate("a\nb: c"),
+		"quote": Populate(`say "hi"`),
+		"url":   Populate("http://host/path"),
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, kv.Write(&buf))
+	back, err := ReadKVString(buf.String())
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{"note", "lines", "quote", "url"}, keysOf(back))
+	for key, v := range kv {
+		assert.Equal(t, v.AsString, back.Get(key).AsString, key)
+	}
+	assert.Contains(t, buf.String(), "url: http://host/path\n")
+
+	// multi-line values from a .env file
+	fileName := filepath.Join(t.TempDir(), ".env")
+	assert.Nil(t, os.WriteFile(fileName, []byte("GREETING=\"hello \\\"world\\\"\\nbye\"\nCERT=\"line 1\nline 2\"\n"+
+		"NOTE=see // here\nLIST=a,b\n"), 0644))
+	kv, err = ReadDotEnv(fileName)
+	assert.Nil(t, err)
+
+	buf.Reset()
+	assert.Nil(t, kv.Write(&buf))
+	back, err = ReadKVString(buf.String())
+	assert.Nil(t, err)
+	assert.Equal(t, kv.Keys(), back.Keys())
+	for _, key := range kv.Keys() {
+		assert.Equal(t, kv.Get(key).AsString, back.Get(key).AsString, key)
+		assert.Equal(t, kv.Get(key).BestType, back.Get(key).BestType, key)
+	}
+}
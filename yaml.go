@@ -0,0 +1,31 @@
+package keyval
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FromYAML reads a YAML mapping from r and returns it as a KeyVal.  Nested mappings are flattened into dot keys
+// and sequences become slice values, as in FromJSON.  The leaves are converted by Populate.
+func FromYAML(r io.Reader) (KeyVal, error) {
+	var obj map[string]any
+	if e := yaml.NewDecoder(r).Decode(&obj); e != nil {
+		return nil, fmt.Errorf("reading yaml: %v", e)
+	}
+
+	return fromTree("yaml", obj)
+}
+
+// ToYAML writes kv to w as a YAML mapping with the keys sorted.  The values are as in MarshalJSON.
+func (kv KeyVal) ToYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+
+	if e := enc.Encode(kv.jsonObject()); e != nil {
+		return e
+	}
+
+	return enc.Close()
+}
@@ -0,0 +1,49 @@
+package keyval
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromYAML(t *testing.T) {
+	const content = `
+name: app
+db:
+  port: 5432
+  hosts: [a, b]
+  opts:
+    ssl: true
+start: 2023-01-15
+rate: 0.5
+`
+	kv, err := FromYAML(strings.NewReader(content))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"db.hosts", "db.opts.ssl", "db.port", "name", "rate", "start"}, kv.Keys())
+	assert.Equal(t, 5432, *kv.Get("db.port").AsInt)
+	assert.Equal(t, []string{"a", "b"}, kv.Get("db.hosts").AsSliceS)
+	assert.True(t, *kv.Get("db.opts.ssl").AsBool)
+	assert.Equal(t, "2023-01-15", kv.Get("start").AsDate.Format("2006-01-02"))
+	assert.Equal(t, 0.5, *kv.Get("rate").AsFloat)
+
+	_, err = FromYAML(strings.NewReader("- a\n- b\n"))
+	assert.NotNil(t, err)
+}
+
+func TestKeyVal_ToYAML(t *testing.T) {
+	kv, err := ReadKVString("port: 8080\nhosts: a, b\nwait: 90s\n")
+	assert.Nil(t, err)
+
+	var buf bytes.Buffer
+	assert.Nil(t, kv.ToYAML(&buf))
+	assert.Equal(t, "hosts:\n  - a\n  - b\nport: 8080\nwait: 1m30s\n", buf.String())
+
+	back, err := FromYAML(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Second, *back.Get("wait").AsDuration)
+	assert.Equal(t, kv.Get("hosts").AsSliceS, back.Get("hosts").AsSliceS)
+}